@@ -8,6 +8,9 @@ import (
 func always(r rune) bool {
 	return true
 }
+func never(r rune) bool {
+	return false
+}
 func equals(r rune) func(rune) bool {
 	return func(ru rune) bool {
 		return ru == r
@@ -15,8 +18,10 @@ func equals(r rune) func(rune) bool {
 }
 
 func Rune(r rune) Parser {
-	return func(st ParseState) (interface{}, error) {
-		ru, ok, err := st.Next(equals(r))
+	pred := equals(r)
+	n := &Node{Kind: "rune", Literals: []string{string(r)}, first: pred}
+	return build(n, func(st ParseState) (interface{}, error) {
+		ru, ok, err := st.Next(pred)
 		if err != nil {
 			return nil, err
 		}
@@ -25,13 +30,14 @@ func Rune(r rune) Parser {
 		} else {
 			return nil, st.Trap("rune '%c' nomatch rune pattern '%c'", ru, r)
 		}
-	}
+	})
 }
 
+var eofNode = &Node{Kind: "eof", empty: true}
+
 func Eof(st ParseState) (interface{}, error) {
-	r, _, err := st.Next(always)
+	r, _, err := st.Next(never)
 	if err == nil {
-		st.SeekTo(st.Pos() - 1)
 		return nil, st.Trap("expect EOF but got %c", r)
 	} else {
 		if err == io.EOF {
@@ -43,28 +49,39 @@ func Eof(st ParseState) (interface{}, error) {
 }
 
 func String(s string) Parser {
-	return func(st ParseState) (interface{}, error) {
-		pos := st.Pos()
+	// 每个字符的判断函数在构造时准备好，匹配时不再分配闭包
+	preds := []func(rune) bool{}
+	for _, r := range s {
+		preds = append(preds, equals(r))
+	}
+	n := &Node{Kind: "string", Literals: []string{s}, empty: s == ""}
+	if len(preds) > 0 {
+		n.first = preds[0]
+	}
+	return build(n, func(st ParseState) (interface{}, error) {
+		cp := Save(st)
 
 		// try and match each character
-		for _, r := range []rune(s) {
-			_, ok, err := st.Next(equals(r))
+		for _, pred := range preds {
+			_, ok, err := st.Next(pred)
 			if err != nil {
-				st.SeekTo(pos)
+				Restore(st, cp)
 				return nil, err
 			}
 
 			if !ok {
-				st.SeekTo(pos)
+				Restore(st, cp)
 				// the string failed to match
 				return nil, st.Trap("Expected '%s'", s)
 			}
 		}
 
 		return s, nil
-	}
+	})
 }
 
+var anyRuneNode = &Node{Kind: "anyRune", first: always}
+
 func AnyRune(st ParseState) (interface{}, error) {
 	c, _, err := st.Next(always)
 
@@ -80,7 +97,8 @@ func AnyRune(st ParseState) (interface{}, error) {
 }
 
 func RuneChecker(checker func(rune) bool, expected string) Parser {
-	return func(st ParseState) (interface{}, error) {
+	n := &Node{Kind: "runeChecker", Expected: expected, first: checker}
+	return build(n, func(st ParseState) (interface{}, error) {
 		r, ok, err := st.Next(checker)
 
 		if err == nil {
@@ -96,7 +114,7 @@ func RuneChecker(checker func(rune) bool, expected string) Parser {
 				return nil, err
 			}
 		}
-	}
+	})
 }
 
 var Space = RuneChecker(unicode.IsSpace, "space")
@@ -108,26 +126,32 @@ var NewLine = OneOf(NewLineRunes)
 var Eol = Either(Eof, NewLine)
 var Digit = RuneChecker(unicode.IsDigit, "digit")
 
+// minus 、digits 和 fraction 是 Int 和 UnsignedFloat 在执行时用到的 parser ，预先构造
+// 好，不必在每次调用时重新构造
+var minus = Try(Rune('-'))
+var digits = Many1(Digit)
+var fraction = Bind_(Rune('.'), digits)
+
 func Int(st ParseState) (interface{}, error) {
-	pos := st.Pos()
+	cp := Save(st)
 	values := []interface{}{}
-	_, err := Try(Rune('-'))(st)
+	_, err := minus(st)
 	if err == nil {
 		values = append(values, '-')
 	}
-	v, err := Many1(Digit)(st)
+	v, err := digits(st)
 	if err == nil {
 		values = append(values, v.([]interface{})...)
-		return ExtractString(values), nil
+		return TryExtractString(values)
 	} else {
-		st.SeekTo(pos)
+		Restore(st, cp)
 		return nil, err
 	}
 }
 
 var UnsignedFloat = Bind(Many(Digit), func(input interface{}) Parser {
 	return func(st ParseState) (interface{}, error) {
-		value, err := Bind_(Rune('.'), Many1(Digit))(st)
+		value, err := fraction(st)
 		if err != nil {
 			return nil, err
 		}
@@ -135,7 +159,7 @@ var UnsignedFloat = Bind(Many(Digit), func(input interface{}) Parser {
 		ret = append(ret, input.([]interface{})...)
 		ret = append(ret, '.')
 		ret = append(ret, value.([]interface{})...)
-		return ExtractString(ret), nil
+		return TryExtractString(ret)
 	}
 })
 
@@ -143,9 +167,223 @@ var Float = Either(UnsignedFloat,
 	Bind_(Rune('-'), func(st ParseState) (interface{}, error) {
 		value, err := UnsignedFloat(st)
 		if err == nil {
-			return ExtractString(append([]interface{}{'-'},
-				value.([]interface{})...)), nil
+			return "-" + value.(string), nil
 		} else {
 			return nil, err
 		}
 	}))
+
+// TakeWhile 消耗所有满足 pred 的连续字符并以 string 返回，可以匹配空串。
+// 它直接在 state 的缓冲上扫描，不会像 Bind(Many(...), ReturnString) 那样为每个字符分配
+// interface{} 。
+func TakeWhile(pred func(rune) bool) Parser {
+	n := &Node{Kind: "takeWhile", first: pred, empty: true}
+	return build(n, func(st ParseState) (interface{}, error) {
+		return takeWhile(st, pred)
+	})
+}
+
+// TakeWhile1 与 TakeWhile 相同，但是至少要匹配一个字符
+func TakeWhile1(pred func(rune) bool) Parser {
+	n := &Node{Kind: "takeWhile1", first: pred}
+	return build(n, func(st ParseState) (interface{}, error) {
+		r, ok, err := st.Next(pred)
+		if err != nil {
+			if err == io.EOF {
+				return nil, st.Trap("Unexpected end of file")
+			}
+			return nil, err
+		}
+		if !ok {
+			return nil, st.Trap("TakeWhile1 got unexpected '%c'", r)
+		}
+		rest, err := takeWhile(st, pred)
+		if err != nil {
+			return nil, err
+		}
+		return string(r) + rest.(string), nil
+	})
+}
+
+// SkipWhile 跳过所有满足 pred 的连续字符，返回 nil
+func SkipWhile(pred func(rune) bool) Parser {
+	n := &Node{Kind: "skipWhile", first: pred, empty: true}
+	return build(n, func(st ParseState) (interface{}, error) {
+		if sc, ok := st.(Scanner); ok {
+			_, err := sc.ScanWhile(pred)
+			return nil, err
+		}
+		for {
+			_, ok, err := st.Next(pred)
+			if err == io.EOF || (err == nil && !ok) {
+				return nil, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	})
+}
+
+func takeWhile(st ParseState, pred func(rune) bool) (interface{}, error) {
+	if sc, ok := st.(Scanner); ok {
+		text, err := sc.ScanWhile(pred)
+		if err != nil {
+			return nil, err
+		}
+		return text, nil
+	}
+	buffer := []rune{}
+	for {
+		r, ok, err := st.Next(pred)
+		if err == io.EOF || (err == nil && !ok) {
+			return string(buffer), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		buffer = append(buffer, r)
+	}
+}
+
+// TakeUntil 消耗 s 出现之前的所有字符并以 string 返回，s 本身不会被消耗。如果直到输入
+// 结束 s 都没有出现，TakeUntil 不消耗输入并返回错误。
+func TakeUntil(s string) Parser {
+	n := &Node{Kind: "takeUntil", first: always, empty: true}
+	target := []rune(s)
+	return build(n, func(st ParseState) (interface{}, error) {
+		if sc, ok := st.(Scanner); ok {
+			text, ok, err := sc.ScanUntil(s)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				return text, nil
+			}
+			return nil, st.Trap("Expected '%s' but not found", s)
+		}
+		start := Save(st)
+		buffer := []rune{}
+		for {
+			pos := Save(st)
+			matched := true
+			for _, r := range target {
+				_, ok, err := st.Next(equals(r))
+				if err != nil && err != io.EOF {
+					Restore(st, start)
+					return nil, err
+				}
+				if !ok {
+					matched = false
+					break
+				}
+			}
+			Restore(st, pos)
+			if matched {
+				return string(buffer), nil
+			}
+			r, _, err := st.Next(always)
+			if err != nil {
+				Restore(st, start)
+				if err == io.EOF {
+					return nil, st.Trap("Expected '%s' but not found", s)
+				}
+				return nil, err
+			}
+			buffer = append(buffer, r)
+		}
+	})
+}
+
+// Span 执行 p ，成功时忽略 p 的结果，返回 p 消耗的输入内容。
+func Span(p Parser) Parser {
+	n := &Node{Kind: "span", Children: []Parser{p}}
+	return nest(n, func(st ParseState) (interface{}, error) {
+		if sc, ok := st.(Scanner); ok {
+			from := st.Pos()
+			if _, err := p(st); err != nil {
+				return nil, err
+			}
+			return sc.Text(from, st.Pos()), nil
+		}
+		// 不能重新读取的 state 在 p 执行时记录读到的字符，p 写入的用户数据和警告都会保留
+		rec := &recordState{ParseState: st, from: st.Pos()}
+		if _, err := p(rec); err != nil {
+			return nil, err
+		}
+		return rec.text(st.Pos()), nil
+	})
+}
+
+// recordState 记录 Span 的 p 从 from 开始读到的字符，回溯之后重新读取的字符覆盖原来的
+// 记录。它转发 Checkpointer 、Observable 、Warnings 和内部计数的接口，Indentation 和
+// UserState 由 indentation 和 userState 通过 unwrap 找到。
+type recordState struct {
+	ParseState
+	from  int
+	runes []rune
+}
+
+func (this *recordState) Next(pred func(rune) bool) (rune, bool, error) {
+	pos := this.ParseState.Pos()
+	r, ok, err := this.ParseState.Next(pred)
+	if err == nil && ok {
+		if idx := pos - this.from; idx >= 0 && idx <= len(this.runes) {
+			this.runes = append(this.runes[:idx], r)
+		}
+	}
+	return r, ok, err
+}
+
+// text 返回 from 到 to 之间记录的字符
+func (this *recordState) text(to int) string {
+	if size := to - this.from; size < len(this.runes) {
+		return string(this.runes[:size])
+	}
+	return string(this.runes)
+}
+
+func (this *recordState) unwrap() ParseState {
+	return this.ParseState
+}
+
+func (this *recordState) Checkpoint() Checkpoint {
+	return Save(this.ParseState)
+}
+
+func (this *recordState) Restore(cp Checkpoint) {
+	Restore(this.ParseState, cp)
+}
+
+func (this *recordState) Observer() Observer {
+	return observerOf(this.ParseState)
+}
+
+func (this *recordState) SetObserver(observer Observer) {
+	if o, ok := this.ParseState.(Observable); ok {
+		o.SetObserver(observer)
+	}
+}
+
+func (this *recordState) AddWarning(warning ParseError) {
+	if w, ok := this.ParseState.(Warnings); ok {
+		w.AddWarning(warning)
+	}
+}
+
+func (this *recordState) Warnings() []ParseError {
+	if w, ok := this.ParseState.(Warnings); ok {
+		return w.Warnings()
+	}
+	return nil
+}
+
+func (this *recordState) limiter() *limiter {
+	return limiterOf(this.ParseState)
+}
+
+func (this *recordState) setLimiter(lim *limiter) {
+	if l, ok := this.ParseState.(limited); ok {
+		l.setLimiter(lim)
+	}
+}
@@ -0,0 +1,92 @@
+package goparsec
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+	"unicode"
+)
+
+// 这里的 benchmark 以 examples/markdown.go 的正文解析为例，对比每次执行都构造判断闭包、
+// 用 strings.IndexRune 扫描字符集合的旧写法，和预先编译的 RuneSet 以及 TakeWhile 。
+
+func markdownText(b *testing.B) string {
+	data, err := ioutil.ReadFile("examples/test_data/withLink.text")
+	if err != nil {
+		b.Fatal(err)
+	}
+	return string(data)
+}
+
+// noneOfIndexRune 是 NoneOf 原来的实现方式
+func noneOfIndexRune(runes string) Parser {
+	return func(st ParseState) (interface{}, error) {
+		r, ok, err := st.Next(func(ru rune) bool { return strings.IndexRune(runes, ru) < 0 })
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return r, nil
+		}
+		return nil, st.Trap("expected none of \"%s\" but got '%c'", runes, r)
+	}
+}
+
+func benchmarkMarkdown(b *testing.B, text Parser) {
+	data := markdownText(b)
+	paragraph := Many(Either(text, Bind_(Rune('['), Return("["))))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := paragraph(MemoryParseState(data)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMarkdownIndexRune(b *testing.B) {
+	benchmarkMarkdown(b, Bind(Many1(noneOfIndexRune("["+NewLineRunes)), ReturnString))
+}
+
+func BenchmarkMarkdownRuneSet(b *testing.B) {
+	benchmarkMarkdown(b, Bind(Many1(NoneOf("["+NewLineRunes)), ReturnString))
+}
+
+func BenchmarkMarkdownTakeWhile(b *testing.B) {
+	excludes := NewRuneSet("[" + NewLineRunes)
+	benchmarkMarkdown(b, TakeWhile1(func(r rune) bool { return !excludes.Contains(r) }))
+}
+
+// 下面的 benchmark 使用大量回溯的 grammar ，衡量 Try 、Either 、Choice 和 Rule 中的
+// 观察点在没有 Observer 和挂载了 Observer 时的开销。
+
+func backtrackGrammar() Parser {
+	keyword := Either(Try(String("let")), Try(String("var")))
+	name := TakeWhile1(unicode.IsLetter)
+	value := Choice(Try(Bind_(String("0x"), TakeWhile1(isHexDigit))), Int, name)
+	stmt := Rule("stmt", Bind_(keyword, Bind_(Spaces, Bind_(name, Bind_(Spaces,
+		Bind_(Rune('='), Bind_(Spaces, Bind_(value, Rune(';')))))))))
+	return Many(Bind_(Spaces, stmt))
+}
+
+func benchmarkBacktracking(b *testing.B, observer Observer) {
+	data := strings.TrimSpace(strings.Repeat("let x = 12; var y = abc; let z = 0x1f; ", 50))
+	program := backtrackGrammar()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		st := MemoryParseState(data)
+		if observer != nil {
+			st.(Observable).SetObserver(observer)
+		}
+		if _, err := program(st); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkBacktracking(b *testing.B) {
+	benchmarkBacktracking(b, nil)
+}
+
+func BenchmarkBacktrackingObserved(b *testing.B) {
+	benchmarkBacktracking(b, NewCoverage(backtrackGrammar()))
+}
@@ -0,0 +1,206 @@
+package goparsec
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ClassError 表示 Class 的字符集合描述不合法
+type ClassError struct {
+	Spec    string
+	Pos     int
+	Message string
+}
+
+func (err ClassError) Error() string {
+	return fmt.Sprintf("invalid class %q at %d: %s", err.Spec, err.Pos, err.Message)
+}
+
+// perlClasses 是 \d \w \s 的定义，大写形式表示补集
+var perlClasses = map[rune]string{
+	'd': "0123456789",
+	'w': "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz_",
+	's': "\t\n\f\r ",
+}
+
+var classEscapes = map[rune]rune{
+	'a': '\a', 'f': '\f', 'n': '\n', 'r': '\r', 't': '\t', 'v': '\v', '0': '\000',
+}
+
+// ParseClass 按照正则表达式方括号内的语法解析 spec 并构造 RuneSet ，例如
+// "a-zA-Z_\\p{Han}" 。支持开头的 ^ 取反、区间、\n \t \xHH \x{HHHH} \uHHHH 这样的转义、
+// \d \w \s 及其大写形式，以及 \p{Name} / \P{Name} 形式的 unicode 类别和文字。
+func ParseClass(spec string) (*RuneSet, error) {
+	c := classParser{spec: spec}
+	return c.parse()
+}
+
+// Class 构造一个匹配 spec 描述的单个字符的 Parser ，spec 的语法见 ParseClass 。
+// spec 不合法时 Class 会在构造时 panic ，就像 regexp.MustCompile 一样。
+func Class(spec string) Parser {
+	set, err := ParseClass(spec)
+	if err != nil {
+		panic(err)
+	}
+	return RuneChecker(set.Contains, "["+spec+"]")
+}
+
+type classParser struct {
+	spec string
+	pos  int
+}
+
+func (this *classParser) fail(pos int, message string, args ...interface{}) error {
+	return ClassError{this.spec, pos, fmt.Sprintf(message, args...)}
+}
+
+func (this *classParser) eof() bool {
+	return this.pos >= len(this.spec)
+}
+
+func (this *classParser) next() rune {
+	r, size := utf8.DecodeRuneInString(this.spec[this.pos:])
+	this.pos += size
+	return r
+}
+
+func (this *classParser) parse() (*RuneSet, error) {
+	set := new(RuneSet)
+	if this.spec == "" {
+		return nil, this.fail(0, "empty class")
+	}
+	negate := false
+	if this.spec[0] == '^' {
+		negate = true
+		this.pos++
+		if this.eof() {
+			return nil, this.fail(this.pos, "empty class")
+		}
+	}
+	for !this.eof() {
+		start := this.pos
+		lo, isRune, err := this.item(set)
+		if err != nil {
+			return nil, err
+		}
+		if !isRune {
+			continue
+		}
+		// 区间，结尾的 - 按字面处理
+		if this.pos+1 < len(this.spec) && this.spec[this.pos] == '-' {
+			this.pos++
+			hi, isRune, err := this.item(set)
+			if err != nil {
+				return nil, err
+			}
+			if !isRune {
+				return nil, this.fail(start, "invalid range end")
+			}
+			if lo > hi {
+				return nil, this.fail(start, "invalid range %c-%c", lo, hi)
+			}
+			set.AddRange(lo, hi)
+			continue
+		}
+		set.AddRange(lo, lo)
+	}
+	if negate {
+		return set.Complement(), nil
+	}
+	return set, nil
+}
+
+// item 读取一个字符或者一个转义。如果读到的是单个字符，返回它并且 isRune 为 true ，
+// 否则读到的字符类已经加入 set 。
+func (this *classParser) item(set *RuneSet) (r rune, isRune bool, err error) {
+	r = this.next()
+	if r == utf8.RuneError {
+		return r, false, this.fail(this.pos-1, "invalid utf-8")
+	}
+	if r != '\\' {
+		return r, true, nil
+	}
+	start := this.pos - 1
+	if this.eof() {
+		return r, false, this.fail(start, "trailing backslash")
+	}
+	r = this.next()
+	if ru, ok := classEscapes[r]; ok {
+		return ru, true, nil
+	}
+	switch r {
+	case 'd', 'w', 's':
+		set.AddRunes(perlClasses[r])
+		return r, false, nil
+	case 'D', 'W', 'S':
+		set.addExcept(NewRuneSet(perlClasses[unicode.ToLower(r)]))
+		return r, false, nil
+	case 'p', 'P':
+		table, err := this.table(start)
+		if err != nil {
+			return r, false, err
+		}
+		if r == 'p' {
+			set.AddTable(table)
+		} else {
+			set.addExcept(new(RuneSet).AddTable(table))
+		}
+		return r, false, nil
+	case 'x':
+		if !this.eof() && this.spec[this.pos] == '{' {
+			return this.hex(start, strings.IndexByte(this.spec[this.pos:], '}')-1, 1)
+		}
+		return this.hex(start, 2, 0)
+	case 'u':
+		return this.hex(start, 4, 0)
+	case 'U':
+		return this.hex(start, 8, 0)
+	}
+	if r < utf8.RuneSelf && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+		// 标点符号的转义都按字面处理，例如 \] \- \^ \\
+		return r, true, nil
+	}
+	return r, false, this.fail(start, "unknown escape \\%c", r)
+}
+
+// hex 读取 skip 个字符之后的 size 个十六进制数字，skip 用于跳过 \x{...} 的括号
+func (this *classParser) hex(start, size, skip int) (rune, bool, error) {
+	from := this.pos + skip
+	if size <= 0 || from+size+skip > len(this.spec) {
+		return 0, false, this.fail(start, "invalid hex escape")
+	}
+	value, err := strconv.ParseUint(this.spec[from:from+size], 16, 32)
+	if err != nil || value > unicode.MaxRune {
+		return 0, false, this.fail(start, "invalid hex escape")
+	}
+	this.pos = from + size + skip
+	return rune(value), true, nil
+}
+
+// table 读取 \p 之后的 unicode 类别或文字名，可以是 {Name} 或者单个字母
+func (this *classParser) table(start int) (*unicode.RangeTable, error) {
+	if this.eof() {
+		return nil, this.fail(start, "missing unicode class name")
+	}
+	var name string
+	if this.spec[this.pos] == '{' {
+		end := strings.IndexByte(this.spec[this.pos:], '}')
+		if end < 0 {
+			return nil, this.fail(start, "unterminated unicode class")
+		}
+		name = this.spec[this.pos+1 : this.pos+end]
+		this.pos += end + 1
+	} else {
+		name = string(this.next())
+	}
+	if table, ok := unicode.Categories[name]; ok {
+		return table, nil
+	}
+	if table, ok := unicode.Scripts[name]; ok {
+		return table, nil
+	}
+	return nil, this.fail(start, "unknown unicode class %s", name)
+}
@@ -1,86 +1,139 @@
 package goparsec
 
-import "strings"
+import (
+	"io"
+	"sync"
+)
 
 func Try(parser Parser) Parser {
-	return func(st ParseState) (interface{}, error) {
-		pos := st.Pos()
+	n := &Node{Kind: "try", Children: []Parser{parser}}
+	return nest(n, func(st ParseState) (interface{}, error) {
+		cp := Save(st)
 		result, err := parser(st)
 		if err == nil {
 			return result, nil
 		} else {
-			st.SeekTo(pos)
+			rewind(st, cp)
 			return nil, err
 		}
-	}
+	})
 }
 func Bind(parser Parser, fun func(interface{}) Parser) Parser {
-	return func(st ParseState) (interface{}, error) {
+	n := &Node{Kind: "bind", Children: []Parser{parser}}
+	return nest(n, func(st ParseState) (interface{}, error) {
 		result, err := parser(st)
 		if err != nil {
 			return nil, err
 		}
 		return fun(result)(st)
-	}
+	})
 }
 
 func Bind_(parserx, parsery Parser) Parser {
-	return func(st ParseState) (interface{}, error) {
+	n := &Node{Kind: "bind_", Children: []Parser{parserx, parsery}}
+	return nest(n, func(st ParseState) (interface{}, error) {
 		_, err := parserx(st)
 		if err != nil {
 			return nil, err
 		}
 		return parsery(st)
-	}
+	})
 }
 
 // try one parser, if it fails (without consuming input) try the next
 func Either(parserx, parsery Parser) Parser {
-	return func(st ParseState) (interface{}, error) {
+	n := &Node{Kind: "either", Children: []Parser{parserx, parsery}}
+	return nest(n, func(st ParseState) (interface{}, error) {
 		pos := st.Pos()
+		cp := Save(st)
 		x, err := parserx(st)
 		if err == nil {
+			chosen(st, n, 0)
 			return x, nil
 		} else {
 			if st.Pos() == pos {
-				return parsery(st)
+				Restore(st, cp)
+				y, err := parsery(st)
+				if err == nil {
+					chosen(st, n, 1)
+				}
+				return y, err
 			}
 		}
 		return nil, err
-	}
+	})
 }
+// returnNode 和 failNode 没有参数，Return 和 Fail 常常在 Bind 中构造，共用同一个节点
+var returnNode = &Node{Kind: "return", empty: true}
+var failNode = &Node{Kind: "fail"}
+
 func Return(v interface{}) Parser {
-	return func(st ParseState) (interface{}, error) {
+	return build(returnNode, func(st ParseState) (interface{}, error) {
 		return v, nil
-	}
+	})
 }
 func Option(v interface{}, parser Parser) Parser {
-	return func(st ParseState) (interface{}, error) {
-		return Either(parser, Return(v))(st)
+	n := &Node{Kind: "option", Children: []Parser{parser}, empty: true}
+	either := Either(parser, Return(v))
+	return build(n, func(st ParseState) (interface{}, error) {
+		return either(st)
+	})
+}
+
+// noProgress 用于重复类的组合子，内部的 parser 成功但是没有消耗输入时，继续重复只会
+// 陷入死循环，所以报错退出。
+func noProgress(st ParseState, combinator string) error {
+	return st.Trap("%s: parser succeeded without consuming input, repeating it would loop forever",
+		combinator)
+}
+
+// many 从 values 开始持续执行 parser，直到它不消耗输入地失败
+func many(st ParseState, combinator string, parser Parser, values []interface{}) (interface{}, error) {
+	for {
+		pos := st.Pos()
+		cp := Save(st)
+		value, err := parser(st)
+		if err != nil {
+			if st.Pos() == pos {
+				Restore(st, cp)
+				return values, nil
+			}
+			return nil, err
+		}
+		if st.Pos() == pos {
+			return nil, noProgress(st, combinator)
+		}
+		values = append(values, value)
 	}
 }
+
 func Many1(parser Parser) Parser {
-	head := func(value interface{}) Parser {
-		tail := func(values interface{}) Parser {
-			return Return(append([]interface{}{value}, values.([]interface{})...))
+	n := &Node{Kind: "many1", Children: []Parser{parser}}
+	return nest(n, func(st ParseState) (interface{}, error) {
+		value, err := parser(st)
+		if err != nil {
+			return nil, err
 		}
-		return Bind(Many(parser), tail)
-	}
-	return Bind(parser, head)
+		return many(st, "Many1", parser, []interface{}{value})
+	})
 }
 func Many(parser Parser) Parser {
-	return func(st ParseState) (interface{}, error) {
-		return Option([]interface{}{}, Many1(parser))(st)
-	}
+	n := &Node{Kind: "many", Children: []Parser{parser}, empty: true}
+	return nest(n, func(st ParseState) (interface{}, error) {
+		return many(st, "Many", parser, []interface{}{})
+	})
 }
 func Fail(message string) Parser {
-	return func(st ParseState) (interface{}, error) {
+	return build(failNode, func(st ParseState) (interface{}, error) {
 		return nil, st.Trap(message)
-	}
+	})
 }
 func OneOf(runes string) Parser {
-	return func(st ParseState) (interface{}, error) {
-		r, ok, err := st.Next(func(ru rune) bool { return strings.IndexRune(runes, ru) >= 0 })
+	set := NewRuneSet(runes)
+	pred := set.Contains
+	n := &Node{Kind: "oneOf", Literals: runeLiterals(runes), first: pred}
+	return build(n, func(st ParseState) (interface{}, error) {
+		r, ok, err := st.Next(pred)
 		if err != nil {
 			return nil, err
 		}
@@ -90,11 +143,14 @@ func OneOf(runes string) Parser {
 		} else {
 			return nil, st.Trap("expected one of \"%s\" but got '%c'", runes, r)
 		}
-	}
+	})
 }
 func NoneOf(runes string) Parser {
-	return func(st ParseState) (interface{}, error) {
-		r, ok, err := st.Next(func(ru rune) bool { return strings.IndexRune(runes, ru) < 0 })
+	set := NewRuneSet(runes)
+	pred := func(ru rune) bool { return !set.Contains(ru) }
+	n := &Node{Kind: "noneOf", Literals: runeLiterals(runes), Negated: true, first: pred}
+	return build(n, func(st ParseState) (interface{}, error) {
+		r, ok, err := st.Next(pred)
 		if err != nil {
 			return nil, err
 		}
@@ -104,46 +160,90 @@ func NoneOf(runes string) Parser {
 		} else {
 			return nil, st.Trap("expected none of \"%s\" but got '%c'", string(runes), r)
 		}
-	}
+	})
 }
 func Between(start, end, p Parser) Parser {
-	keep := func(x interface{}) Parser {
-		return Bind_(end, Return(x))
-	}
-	return Bind_(start, Bind(p, keep))
+	n := &Node{Kind: "between", Children: []Parser{start, p, end}}
+	return nest(n, func(st ParseState) (interface{}, error) {
+		_, err := start(st)
+		if err != nil {
+			return nil, err
+		}
+		x, err := p(st)
+		if err != nil {
+			return nil, err
+		}
+		_, err = end(st)
+		if err != nil {
+			return nil, err
+		}
+		return x, nil
+	})
 }
 func SepBy1(p, sep Parser) Parser {
-	head := func(x interface{}) Parser {
-		tail := func(xs interface{}) Parser {
-			return Return(append([]interface{}{x}, xs.([]interface{})...))
+	n := &Node{Kind: "sepBy1", Children: []Parser{p, sep}}
+	next := Bind_(sep, p)
+	return nest(n, func(st ParseState) (interface{}, error) {
+		x, err := p(st)
+		if err != nil {
+			return nil, err
 		}
-		return Bind(Many(Bind_(sep, p)), tail)
-	}
-	return Bind(p, head)
+		return many(st, "SepBy1", next, []interface{}{x})
+	})
 }
 func SepBy(p, sep Parser) Parser {
 	return Option([]interface{}{}, SepBy1(p, sep))
 }
 func ManyTil(p, end Parser) Parser {
-	head := func(x interface{}) Parser {
-		tail := func(xs interface{}) Parser {
-			return Return(append([]interface{}{x}, xs.([]interface{})...))
+	n := &Node{Kind: "manyTil", Children: []Parser{p, end}}
+	term := Try(end)
+	return nest(n, func(st ParseState) (interface{}, error) {
+		values := []interface{}{}
+		for {
+			pos := st.Pos()
+			if _, err := term(st); err == nil {
+				return values, nil
+			}
+			x, err := p(st)
+			if err != nil {
+				return nil, err
+			}
+			if st.Pos() == pos {
+				return nil, noProgress(st, "ManyTil")
+			}
+			values = append(values, x)
 		}
-
-		return Bind(ManyTil(p, end), tail)
-	}
-	term := Bind_(Try(end), Return([]interface{}{}))
-	return Either(term, Bind(p, head))
+	})
 }
 func Maybe(p Parser) Parser {
 	return Option(nil, Bind_(p, Return(nil)))
 }
+
+// Skip 跳过 p 的零次或多次匹配，与 Many 一样，p 成功但不消耗输入时报错
 func Skip(p Parser) Parser {
-	return Maybe(Many(p))
+	n := &Node{Kind: "skip", Children: []Parser{p}, empty: true}
+	return nest(n, func(st ParseState) (interface{}, error) {
+		for {
+			pos := st.Pos()
+			cp := Save(st)
+			_, err := p(st)
+			if err != nil {
+				if st.Pos() == pos {
+					Restore(st, cp)
+					return nil, nil
+				}
+				return nil, err
+			}
+			if st.Pos() == pos {
+				return nil, noProgress(st, "Skip")
+			}
+		}
+	})
 }
 
 func Union(parsers ...Parser) Parser {
-	return func(st ParseState) (interface{}, error) {
+	n := &Node{Kind: "union", Children: parsers}
+	return nest(n, func(st ParseState) (interface{}, error) {
 		var ret = make([]interface{}, 0, len(parsers))
 		for _, parser := range parsers {
 			val, err := parser(st)
@@ -156,11 +256,12 @@ func Union(parsers ...Parser) Parser {
 			}
 		}
 		return ret, nil
-	}
+	})
 }
 
 func UnionAll(parsers ...Parser) Parser {
-	return func(st ParseState) (interface{}, error) {
+	n := &Node{Kind: "unionAll", Children: parsers}
+	return nest(n, func(st ParseState) (interface{}, error) {
 		var ret = make([]interface{}, 0, len(parsers))
 		for _, parser := range parsers {
 			val, err := parser(st)
@@ -171,7 +272,7 @@ func UnionAll(parsers ...Parser) Parser {
 			}
 		}
 		return ret, nil
-	}
+	})
 }
 
 // Choice 实现为以下逻辑的迭代版本：
@@ -188,18 +289,97 @@ func UnionAll(parsers ...Parser) Parser {
 // 	}
 // }
 // 其实我比较希望把下面那个东西实现成上面这个样子，就是好像在golang里不太经济……
+//
+// 如果能分析出分支可以接受的第一个字符，Choice 会先查看下一个字符，只尝试可能匹配的分支。
+// 无法分析的分支总是按原来的顺序尝试。分析在第一次执行时进行，这样递归定义的 grammar
+// 在构造时不需要所有的分支都已经就绪。
 func Choice(parsers ...Parser) Parser {
-	return func(st ParseState) (interface{}, error) {
-		var err error
+	n := &Node{Kind: "choice", Children: parsers}
+	var once sync.Once
+	var table *dispatch
+	return nest(n, func(st ParseState) (interface{}, error) {
+		once.Do(func() {
+			table = newDispatch(parsers)
+		})
+		if table == nil {
+			return choice(st, n, 0, nil)
+		}
+		// never 不接受任何字符，这里用它查看下一个字符而不消耗输入
+		r, _, err := st.Next(never)
+		var candidates []int
+		indexed := false
+		switch {
+		case err == io.EOF:
+			candidates, indexed = table.eof, true
+		case err != nil:
+			return choice(st, n, 0, nil)
+		case r >= 0 && int(r) < len(table.ascii):
+			candidates, indexed = table.ascii[r], true
+		}
+		pos := st.Pos()
+		cp := Save(st)
+		tried := -1
 		var result interface{}
-		for _, parser := range parsers {
-			result, err = parser(st)
+		attempt := func(idx int) bool {
+			tried = idx
+			result, err = parsers[idx](st)
+			if err == nil || st.Pos() != pos {
+				return true
+			}
+			Restore(st, cp)
+			return false
+		}
+		if indexed {
+			for _, idx := range candidates {
+				if attempt(idx) {
+					break
+				}
+			}
+		} else {
+			for idx := range parsers {
+				if table.match(idx, r) && attempt(idx) {
+					break
+				}
+			}
+		}
+		if tried >= 0 {
 			if err == nil {
+				chosen(st, n, tried)
 				return result, nil
 			}
+			if st.Pos() != pos {
+				// 分支消耗了输入，剩下的分支要从新的位置开始尝试，查找表不再适用
+				return choice(st, n, tried+1, err)
+			}
+		}
+		if last := len(parsers) - 1; tried != last {
+			// 保持和逐个尝试时一致的错误信息
+			result, err = parsers[last](st)
+			if err == nil {
+				chosen(st, n, last)
+			}
+			return result, err
 		}
 		return nil, err
+	})
+}
+
+// choice 从第 from 个分支开始逐个尝试 n 的每一个分支，err 是全部失败时返回的错误
+func choice(st ParseState, n *Node, from int, err error) (interface{}, error) {
+	var result interface{}
+	pos := st.Pos()
+	cp := Save(st)
+	for idx := from; idx < len(n.Children); idx++ {
+		result, err = n.Children[idx](st)
+		if err == nil {
+			chosen(st, n, idx)
+			return result, nil
+		}
+		if st.Pos() == pos {
+			Restore(st, cp)
+		}
 	}
+	return nil, err
 }
 
 // Binds 相当于用 Bind 对一个 func(interface{})Parser 链做左折叠，起始参数为 first
@@ -210,14 +390,15 @@ func Binds(first Parser, then ...func(interface{}) Parser) Parser {
 	if len(then) == 1 {
 		return Bind(first, then[0])
 	}
-	return func(st ParseState) (interface{}, error) {
+	n := &Node{Kind: "bind", Children: []Parser{first}}
+	return nest(n, func(st ParseState) (interface{}, error) {
 		ret, err := first(st)
 		if err != nil {
 			return nil, err
 		}
 		next := then[0](ret)
 		return Binds(next, then[1:]...)(st)
-	}
+	})
 }
 
 // Binds_ 逐个尝试每一个 Parser，直至发生错误或者到达最后，如果到达最后一个 Parser，
@@ -1,7 +1,20 @@
 package goparsec
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"unicode"
 )
 
 func TestBinds_(t *testing.T) {
@@ -23,3 +36,1206 @@ func TestBindsFail_(t *testing.T) {
 		t.Fatalf("expect the Binds_ checker failed at \"%s\"", data)
 	}
 }
+
+func TestManyNoProgress(t *testing.T) {
+	st := MemoryParseState("abc")
+	_, err := Many(Maybe(Rune('x')))(st)
+	if err == nil {
+		t.Fatalf("expect Many(Maybe(x)) failed without consuming input but it success")
+	}
+}
+
+func TestManyTilNoProgress(t *testing.T) {
+	st := MemoryParseState("abc")
+	_, err := ManyTil(Spaces, Eof)(st)
+	if err == nil {
+		t.Fatalf("expect ManyTil(Spaces, Eof) failed without consuming input but it success")
+	}
+}
+
+func TestSkipNoProgress(t *testing.T) {
+	st := MemoryParseState("   abc")
+	if _, err := Skip(Space)(st); err != nil {
+		t.Fatalf("expect Skip(Space) stop at \"abc\" but %v", err)
+	}
+	if st.Pos() != 3 {
+		t.Fatalf("expect Skip(Space) stop at pos 3 but %d", st.Pos())
+	}
+	if _, err := Skip(Spaces)(st); err == nil {
+		t.Fatalf("expect Skip(Spaces) failed without consuming input but it success")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := Validate(SepBy(Many1(Letter), Spaces)); err != nil {
+		t.Fatalf("expect the grammar is valid but %v", err)
+	}
+	if err := Validate(Between(Rune('('), Rune(')'), Many(Spaces))); err == nil {
+		t.Fatalf("expect Validate report Many(Spaces)")
+	}
+
+	// 分析 grammar 时不执行用户写的 parser ，否则这个只在 Space 失败时结束的循环在
+	// 分析时永远不会结束
+	calls := 0
+	loop := func(st ParseState) (interface{}, error) {
+		calls++
+		for {
+			if _, err := Space(st); err != nil {
+				return nil, nil
+			}
+		}
+	}
+	p := Rule("items", Many(Either(Rune('x'), loop)))
+	if err := Validate(p); err != nil {
+		t.Fatalf("expect the grammar is valid but %v", err)
+	}
+	if _, _, known := First(p); known {
+		t.Fatalf("expect the first set of an opaque parser is unknown")
+	}
+	if err := WriteEBNF(io.Discard, p); err != nil {
+		t.Fatalf("expect write ebnf but %v", err)
+	}
+	NewCoverage(p)
+	if calls != 0 {
+		t.Fatalf("expect grammar analysis never run user parsers but %d calls", calls)
+	}
+}
+
+func TestChoiceDispatch(t *testing.T) {
+	opaque := func(st ParseState) (interface{}, error) {
+		return Rune('c')(st)
+	}
+	parser := Choice(String("ab"), String("ac"), opaque, Rune('中'), Bind_(Rune('d'), Return("d")))
+	for _, data := range []string{"ab", "ac", "c", "中", "d"} {
+		st := MemoryParseState(data)
+		if _, err := parser(st); err != nil {
+			t.Fatalf("expect Choice match \"%s\" but %v", data, err)
+		}
+	}
+	st := MemoryParseState("x")
+	_, err := parser(st)
+	if err == nil {
+		t.Fatalf("expect Choice failed at \"x\"")
+	}
+	if st.Pos() != 0 {
+		t.Fatalf("expect Choice failed without consuming input but pos %d", st.Pos())
+	}
+
+	// 手写的顺序 parser 最后返回的是 Rune(')') ，但是它不能按照 ')' 分派
+	parens := func(st ParseState) (interface{}, error) {
+		if _, err := Rune('(')(st); err != nil {
+			return nil, err
+		}
+		return Rune(')')(st)
+	}
+	if _, err := Choice(parens, String("x"))(MemoryParseState("()")); err != nil {
+		t.Fatalf("expect Choice try the hand-written parser in order but %v", err)
+	}
+	// 只在 Space 失败时结束的循环，分析时执行它会永远不结束
+	spaces := func(st ParseState) (interface{}, error) {
+		count := 0
+		for {
+			if _, err := Space(st); err != nil {
+				return count, nil
+			}
+			count++
+		}
+	}
+	val, err := Choice(spaces, String("x"))(MemoryParseState("  x"))
+	if err != nil || val.(int) != 2 {
+		t.Fatalf("expect Choice run the hand-written loop but %v, %v", val, err)
+	}
+}
+
+// wrapped 隐藏 StateInMemory 的 Scanner 实现，用于测试逐字符读取的实现
+type wrapped struct {
+	ParseState
+}
+
+func TestTakeWhile(t *testing.T) {
+	for _, st := range []ParseState{MemoryParseState("abc123"), wrapped{MemoryParseState("abc123")}} {
+		val, err := TakeWhile1(unicode.IsLetter)(st)
+		if err != nil || val.(string) != "abc" {
+			t.Fatalf("expect TakeWhile1 got \"abc\" but %v, %v", val, err)
+		}
+		val, err = TakeWhile(unicode.IsLetter)(st)
+		if err != nil || val.(string) != "" {
+			t.Fatalf("expect TakeWhile got empty string but %v, %v", val, err)
+		}
+		if _, err = TakeWhile1(unicode.IsLetter)(st); err == nil {
+			t.Fatalf("expect TakeWhile1 failed at \"123\"")
+		}
+		if _, err = SkipWhile(unicode.IsDigit)(st); err != nil || st.Pos() != 6 {
+			t.Fatalf("expect SkipWhile skip to the end but pos %d, %v", st.Pos(), err)
+		}
+	}
+}
+
+func TestTakeUntil(t *testing.T) {
+	for _, st := range []ParseState{MemoryParseState("a <!-- b --> c"), wrapped{MemoryParseState("a <!-- b --> c")}} {
+		if _, err := TakeUntil("?>")(st); err == nil || st.Pos() != 0 {
+			t.Fatalf("expect TakeUntil failed without consuming input but pos %d", st.Pos())
+		}
+		val, err := Bind_(String("a <!--"), TakeUntil("-->"))(st)
+		if err != nil || val.(string) != " b " {
+			t.Fatalf("expect TakeUntil got \" b \" but %v, %v", val, err)
+		}
+		val, err = Span(Binds_(String("-->"), Spaces, Letter))(st)
+		if err != nil || val.(string) != "--> c" {
+			t.Fatalf("expect Span got \"--> c\" but %v, %v", val, err)
+		}
+	}
+}
+
+// unscanned 隐藏 StateInMemory 的 Scanner 实现，保留快照、用户数据和警告
+type unscanned struct {
+	ParseState
+	mem *StateInMemory
+}
+
+func (this unscanned) Checkpoint() Checkpoint        { return this.mem.Checkpoint() }
+func (this unscanned) Restore(cp Checkpoint)         { this.mem.Restore(cp) }
+func (this unscanned) UserData() interface{}         { return this.mem.UserData() }
+func (this unscanned) SetUserData(value interface{}) { this.mem.SetUserData(value) }
+func (this unscanned) AddWarning(warning ParseError) { this.mem.AddWarning(warning) }
+func (this unscanned) Warnings() []ParseError        { return this.mem.Warnings() }
+
+func newUnscanned(data string) unscanned {
+	mem := MemoryParseState(data).(*StateInMemory)
+	return unscanned{mem, mem}
+}
+
+func TestSpan(t *testing.T) {
+	// 没有实现 Scanner 的 state 上，Span 不回退 p 写入的用户数据和警告
+	st := newUnscanned("ab!c")
+	p := Span(Binds_(Letter, PutState("seen"), warnHere, Either(Try(Bind_(Letter, Letter)), Bind_(Letter, Rune('!')))))
+	val, err := p(st)
+	if err != nil || val.(string) != "ab!" {
+		t.Fatalf("expect Span got \"ab!\" but %v, %v", val, err)
+	}
+	if st.UserData() != "seen" || len(st.Warnings()) != 1 {
+		t.Fatalf("expect Span keep user data and warnings but %v, %v", st.UserData(), st.Warnings())
+	}
+
+	// 读取的字符在 p 执行时记录，不会再次计入步数
+	_, err = RunContext(context.Background(), Span(TakeWhile1(unicode.IsLetter)), wrapped{MemoryParseState("abc")},
+		Limits{MaxSteps: 4})
+	if err != nil {
+		t.Fatalf("expect Span read each rune once but %v", err)
+	}
+}
+
+func TestRuneSet(t *testing.T) {
+	set := NewRuneSet("_（").AddRange('a', 'z').AddRange('0', '9').AddTable(unicode.Han)
+	for _, r := range "_az09（中" {
+		if !set.Contains(r) {
+			t.Fatalf("expect %c in the rune set", r)
+		}
+	}
+	for _, r := range "A-）ア" {
+		if set.Contains(r) {
+			t.Fatalf("expect %c not in the rune set", r)
+		}
+	}
+	negative := NewRuneSet("").AddRange(-100, 'b')
+	if !negative.Contains('a') || negative.Contains('c') {
+		t.Fatalf("expect AddRange(-100, 'b') contains runes from 0 to 'b'")
+	}
+	st := MemoryParseState("ab_中-")
+	val, err := Many1(OneOfSet(set, "identifier"))(st)
+	if err != nil || ExtractString(val) != "ab_中" {
+		t.Fatalf("expect OneOfSet got \"ab_中\" but %v, %v", val, err)
+	}
+}
+
+func TestClass(t *testing.T) {
+	ident := Span(Bind_(Class("a-zA-Z_\\p{Han}"), Many(Class("\\w\\p{Han}"))))
+	st := MemoryParseState("_变量1 = 2")
+	val, err := ident(st)
+	if err != nil || val.(string) != "_变量1" {
+		t.Fatalf("expect identifier \"_变量1\" but %v, %v", val, err)
+	}
+	cases := map[string]string{
+		"^0-9":          "a-中",
+		"\\x41-\\x{5A}": "AZ",
+		"\\P{Han}\\-":   "a-",
+		"-a\\]":         "-a]",
+	}
+	for spec, data := range cases {
+		set, err := ParseClass(spec)
+		if err != nil {
+			t.Fatalf("expect class %q is valid but %v", spec, err)
+		}
+		for _, r := range data {
+			if !set.Contains(r) {
+				t.Fatalf("expect %c in class %q", r, spec)
+			}
+		}
+	}
+	if set, _ := ParseClass("^0-9"); set.Contains('5') {
+		t.Fatalf("expect 5 not in class \"^0-9\"")
+	}
+	for _, spec := range []string{"", "^", "z-a", "\\p{Nope}", "\\", "\\q", "\\x{12"} {
+		if _, err := ParseClass(spec); err == nil {
+			t.Fatalf("expect class %q is invalid", spec)
+		}
+	}
+}
+
+func TestRegexp(t *testing.T) {
+	data := "v1.2.3 2016-01-02"
+	for _, st := range []ParseState{MemoryParseState(data), wrapped{MemoryParseState(data)}} {
+		version, err := RegexpSubmatch(`v(\d+)\.(\d+)\.(\d+)(-\w+)?`)(st)
+		if err != nil {
+			t.Fatalf("expect match the version but %v", err)
+		}
+		groups := version.([]string)
+		if groups[0] != "v1.2.3" || groups[2] != "2" || groups[4] != "" {
+			t.Fatalf("expect version groups of v1.2.3 but %v", groups)
+		}
+		if _, err := Regexp(`\d+`)(st); err == nil || st.Pos() != 6 {
+			t.Fatalf("expect Regexp failed without consuming input but pos %d", st.Pos())
+		}
+		date, err := Bind_(Space, Regexp(`\d{4}-\d{2}-\d{2}`))(st)
+		if err != nil || date.(string) != "2016-01-02" {
+			t.Fatalf("expect match the date but %v, %v", date, err)
+		}
+		if _, err := Eof(st); err != nil {
+			t.Fatalf("expect Regexp consume to the end but %v", err)
+		}
+	}
+}
+
+func TestStringFold(t *testing.T) {
+	for _, data := range []string{"select", "SELECT", "SeLeCt"} {
+		if _, err := StringFold("Select")(MemoryParseState(data)); err != nil {
+			t.Fatalf("expect StringFold match \"%s\" but %v", data, err)
+		}
+	}
+	if _, err := StringFold("select")(MemoryParseState("ｓｅｌｅｃｔ")); err == nil {
+		t.Fatalf("expect StringFold not match full width runes")
+	}
+	parser := StringFoldWith("(a)", FoldCase|FoldWidth)
+	for _, data := range []string{"(A)", "（ａ）", "（Ａ)"} {
+		if _, err := parser(MemoryParseState(data)); err != nil {
+			t.Fatalf("expect StringFoldWith match \"%s\" but %v", data, err)
+		}
+	}
+	st := MemoryParseState("（b）")
+	if _, err := parser(st); err == nil || st.Pos() != 0 {
+		t.Fatalf("expect StringFoldWith failed without consuming input at \"（b）\"")
+	}
+}
+
+func TestKeywords(t *testing.T) {
+	parser := Keywords("in", "int", "interface")
+	for data, expect := range map[string]string{"in": "in", "int8": "int", "interfaces": "interface", "inte": "int"} {
+		val, err := parser(MemoryParseState(data))
+		if err != nil || val.(string) != expect {
+			t.Fatalf("expect Keywords got \"%s\" from \"%s\" but %v, %v", expect, data, val, err)
+		}
+	}
+	bounded := KeywordsBounded(unicode.IsLetter, "in", "int", "interface")
+	for data, expect := range map[string]string{"int8": "int", "in x": "in", "interface{}": "interface"} {
+		val, err := bounded(MemoryParseState(data))
+		if err != nil || val.(string) != expect {
+			t.Fatalf("expect KeywordsBounded got \"%s\" from \"%s\" but %v, %v", expect, data, val, err)
+		}
+	}
+	st := MemoryParseState("inner")
+	if _, err := bounded(st); err == nil || st.Pos() != 0 {
+		t.Fatalf("expect KeywordsBounded failed without consuming input at \"inner\"")
+	}
+}
+
+func TestWhiteSpace(t *testing.T) {
+	ws := WhiteSpace(WhiteSpaceConfig{
+		LineComments: []string{";", "//"},
+		BlockStart:   "{-",
+		BlockEnd:     "-}",
+		NestedBlock:  true,
+	})
+	st := MemoryParseState(" ; gisp\n // c\n {- a {- nested -} b -}\tx")
+	if _, err := Bind_(ws, Rune('x'))(st); err != nil {
+		t.Fatalf("expect skip the comments but %v", err)
+	}
+	st = MemoryParseState("  {- a {- b -}\n")
+	_, err := ws(st)
+	if err == nil {
+		t.Fatalf("expect unterminated block comment failed")
+	}
+	if e, ok := err.(ParseError); !ok || e.Pos != 2 {
+		t.Fatalf("expect the error at pos 2 where the comment opened but %v", err)
+	}
+}
+
+func TestNumbers(t *testing.T) {
+	cases := []struct {
+		parser Parser
+		data   string
+		expect interface{}
+	}{
+		{Int64, "-1_000", int64(-1000)},
+		{Int64, "0x1F", int64(31)},
+		{Int64, "0b101", int64(5)},
+		{Uint64, "0o777", uint64(511)},
+		{Float64, "1.", 1.0},
+		{Float64, "-1.5e3", -1500.0},
+		{Float64, ".25", 0.25},
+		{Float, "-1.5", "-1.5"},
+	}
+	for _, c := range cases {
+		val, err := c.parser(MemoryParseState(c.data))
+		if err != nil || val != c.expect {
+			t.Fatalf("expect %v from \"%s\" but %v, %v", c.expect, c.data, val, err)
+		}
+	}
+	val, err := BigInt(MemoryParseState("123456789012345678901234567890"))
+	if err != nil || val.(*big.Int).String() != "123456789012345678901234567890" {
+		t.Fatalf("expect big int but %v, %v", val, err)
+	}
+	st := MemoryParseState("1e5x")
+	if val, err = Float64(st); err != nil || val != 1e5 || st.Pos() != 3 {
+		t.Fatalf("expect 1e5 stop before x but %v, %v", val, err)
+	}
+	st = MemoryParseState("1ex")
+	if val, err = Float64(st); err != nil || val != 1.0 || st.Pos() != 1 {
+		t.Fatalf("expect 1 stop before ex but %v, %v", val, err)
+	}
+	for _, data := range []string{"99999999999999999999", "-1", "1__0", "_1"} {
+		if _, err := Uint64(MemoryParseState(data)); err == nil {
+			t.Fatalf("expect Uint64 failed at \"%s\"", data)
+		}
+	}
+	format := DefaultNumberFormat
+	format.Overflow = func(st ParseState, text, typ string) error {
+		return st.Trap("too large")
+	}
+	_, err = format.Int64()(MemoryParseState("99999999999999999999"))
+	if e, ok := err.(ParseError); !ok || e.Message != "too large" || e.Pos != 0 {
+		t.Fatalf("expect the custom overflow error at pos 0 but %v", err)
+	}
+}
+
+func TestStringLiteral(t *testing.T) {
+	cases := []struct {
+		parser Parser
+		data   string
+		expect string
+	}{
+		{GoString, `"a\tb\x41\101中\U0001F600"`, "a\tbAA中😀"},
+		{GoString, "`raw\\n\nline`", "raw\\n\nline"},
+		{JSONString, `"😀\/"`, "😀/"},
+		{PythonString, `'it\'s \q'`, `it's \q`},
+		{PythonString, `r"\d+"`, `\d+`},
+		{ShellString, `'$HOME\'`, `$HOME\`},
+		{ShellString, `"\$HOME \n"`, `$HOME \n`},
+	}
+	for _, c := range cases {
+		val, err := c.parser(MemoryParseState(c.data))
+		if err != nil || val.(string) != c.expect {
+			t.Fatalf("expect %q from %s but %q, %v", c.expect, c.data, val, err)
+		}
+	}
+	for data, expect := range map[string]rune{`'a'`: 'a', `'\''`: '\'', `'\xff'`: 0xff, `'中'`: '中'} {
+		val, err := GoRune(MemoryParseState(data))
+		if err != nil || val.(rune) != expect {
+			t.Fatalf("expect %q from %s but %v, %v", expect, data, val, err)
+		}
+	}
+	errors := []struct {
+		parser Parser
+		data   string
+		pos    int
+	}{
+		{GoString, `"abc\q"`, 4},
+		{GoString, `"ab\x4"`, 3},
+		{GoString, `"ab\12"`, 3},
+		{JSONString, `"a\ud83d"`, 2},
+		{JSONString, "\"a\tb\"", 2},
+		{GoString, `"abc`, 0},
+	}
+	for _, c := range errors {
+		_, err := c.parser(MemoryParseState(c.data))
+		if e, ok := err.(ParseError); !ok || e.Pos != c.pos {
+			t.Fatalf("expect error at pos %d of %s but %v", c.pos, c.data, err)
+		}
+	}
+}
+
+func TestIndentation(t *testing.T) {
+	var item Parser
+	key := TakeWhile1(unicode.IsLetter)
+	value := TakeWhile1(unicode.IsDigit)
+	trailing := SkipWhile(unicode.IsSpace)
+	item = func(st ParseState) (interface{}, error) {
+		k, err := Bind(key, func(k interface{}) Parser {
+			return Bind_(Rune(':'), Return(k))
+		})(st)
+		if err != nil {
+			return nil, err
+		}
+		v, err := Either(
+			Bind(Bind_(Rune(' '), value), func(v interface{}) Parser {
+				return Bind_(trailing, Return(v))
+			}),
+			Bind_(trailing, Bind_(Indented, Block(item))))(st)
+		if err != nil {
+			return nil, err
+		}
+		return []interface{}{k, v}, nil
+	}
+	data := "a:\n  b: 1\n  c:\n    d: 2\ne: 3\n"
+	val, err := Block(item)(MemoryParseState(data))
+	if err != nil {
+		t.Fatalf("expect parse the block but %v", err)
+	}
+	expect := []interface{}{
+		[]interface{}{"a", []interface{}{
+			[]interface{}{"b", "1"},
+			[]interface{}{"c", []interface{}{[]interface{}{"d", "2"}}},
+		}},
+		[]interface{}{"e", "3"},
+	}
+	if !reflect.DeepEqual(val, expect) {
+		t.Fatalf("expect %v but %v", expect, val)
+	}
+
+	st := MemoryParseState("a:\n  b: 1\n   c: 2\n")
+	_, err = Block(item)(st)
+	if e, ok := err.(ParseError); !ok || e.Line != 3 || e.Message != "incorrect indentation (got 4, expected 3)" {
+		t.Fatalf("expect incorrect indentation error but %v", err)
+	}
+
+	words := LineFold(SkipWhile(unicode.IsSpace), func(space Parser) Parser {
+		return SepBy1(TakeWhile1(unicode.IsLetter), space)
+	})
+	st = MemoryParseState("foo bar\n  baz\nqux")
+	val, err = words(st)
+	if err != nil || !reflect.DeepEqual(val, []interface{}{"foo", "bar", "baz"}) {
+		t.Fatalf("expect fold foo bar baz but %v, %v", val, err)
+	}
+	if st.Line() != 2 || st.Column() != 6 {
+		t.Fatalf("expect stop at line 2 column 6 but %d:%d", st.Line(), st.Column())
+	}
+}
+
+func TestLineColumn(t *testing.T) {
+	st := MemoryParseState("ab\ncd")
+	for _, expect := range [][2]int{{1, 1}, {1, 2}, {1, 3}, {2, 1}, {2, 2}, {2, 3}} {
+		if st.Line() != expect[0] || st.Column() != expect[1] {
+			t.Fatalf("expect %v at pos %d but %d:%d", expect, st.Pos(), st.Line(), st.Column())
+		}
+		line, column, pos := st.Line(), st.Column(), st.Pos()
+		st.SeekTo(0)
+		st.SeekTo(pos)
+		if st.Line() != line || st.Column() != column {
+			t.Fatalf("expect SeekTo(%d) at %d:%d but %d:%d", pos, line, column, st.Line(), st.Column())
+		}
+		AnyRune(st)
+	}
+}
+
+func TestUserState(t *testing.T) {
+	name := TakeWhile1(unicode.IsLetter)
+	declare := Bind(Bind_(String("let "), name), func(x interface{}) Parser {
+		return ModifyState(func(state interface{}) interface{} {
+			// 复制符号表，保证回溯时可以恢复
+			symbols := map[string]bool{x.(string): true}
+			if state != nil {
+				for key := range state.(map[string]bool) {
+					symbols[key] = true
+				}
+			}
+			return symbols
+		})
+	})
+	use := Bind(Bind_(String("use "), name), func(x interface{}) Parser {
+		return func(st ParseState) (interface{}, error) {
+			symbols, _ := GetState(st)
+			if symbols == nil || !symbols.(map[string]bool)[x.(string)] {
+				return nil, st.Trap("%s is not declared", x)
+			}
+			return x, nil
+		}
+	})
+	// 回溯的分支声明了 y ，但是回溯之后 y 不可见
+	stmt := Bind_(Choice(Try(Bind_(declare, String("!"))), declare, use), Rune(';'))
+	program := Many(stmt)
+
+	if _, err := Bind_(program, Eof)(MemoryParseState("let x;use x;")); err != nil {
+		t.Fatalf("expect x is declared but %v", err)
+	}
+	if _, err := Bind_(program, Eof)(MemoryParseState("use x;let x;")); err == nil {
+		t.Fatalf("expect x is not declared before use")
+	}
+	st := MemoryParseState("let y!;let z;use y;")
+	if _, err := Bind_(program, Eof)(st); err != nil {
+		t.Fatalf("expect y is declared but %v", err)
+	}
+
+	st = MemoryParseState("let y;use y;")
+	if _, err := Bind_(Try(Bind_(declare, String("?"))), Eof)(st); err == nil {
+		t.Fatalf("expect fail at ?")
+	}
+	if val, _ := GetState(st); val != nil {
+		t.Fatalf("expect Try restore the user state but %v", val)
+	}
+	if _, err := declare(st); err != nil {
+		t.Fatalf("expect declare y but %v", err)
+	}
+	st.SeekTo(0)
+	if val, _ := GetState(st); val != nil {
+		t.Fatalf("expect SeekTo restore the user state but %v", val)
+	}
+	if _, err := Bind_(PutState(1), Either(Bind_(PutState(2), Fail("zero width")), GetState))(st); err != nil {
+		t.Fatalf("expect put state but %v", err)
+	}
+	if val, _ := GetState(st); val != 1 {
+		t.Fatalf("expect Either rollback the failed branch but %v", val)
+	}
+
+	// Seek 和 Restore 回到同一个位置时得到相同的用户数据
+	mem := MemoryParseState("abcd").(*StateInMemory)
+	mem.SetUserData(0)
+	mem.Next(always)
+	mem.SetUserData(1)
+	cp := mem.Checkpoint()
+	for idx := 2; idx < 5; idx++ {
+		mem.Next(always)
+		mem.SetUserData(idx)
+	}
+	mem.Restore(cp)
+	restored := mem.UserData()
+	for idx := 2; idx < 5; idx++ {
+		mem.Next(always)
+		mem.SetUserData(idx)
+	}
+	if err := mem.Seek(1); err != nil || mem.UserData() != restored || restored != 1 {
+		t.Fatalf("expect Seek and Restore both get 1 but %v, %v, %v", mem.UserData(), restored, err)
+	}
+	// 快照之后在同一个位置写入的值由 Restore 回退
+	cp = mem.Checkpoint()
+	mem.SetUserData(2)
+	mem.Restore(cp)
+	if mem.UserData() != 1 {
+		t.Fatalf("expect Restore rollback the value written at the checkpoint but %v", mem.UserData())
+	}
+	// 同一个位置反复写入不会让保存的用户数据增长
+	for idx := 0; idx < 100; idx++ {
+		mem.SetUserData(idx)
+	}
+	if len(mem.user) != 2 {
+		t.Fatalf("expect keep 2 user entries but %d", len(mem.user))
+	}
+}
+
+func TestCheckpoint(t *testing.T) {
+	st := MemoryParseState("ab\ncd")
+	st.(Indentation).SetIndent(3)
+	PutState("start")(st)
+	cp := Save(st)
+	if _, err := Bind_(String("ab\nc"), PutState("changed"))(st); err != nil {
+		t.Fatalf("expect parse ab\\nc but %v", err)
+	}
+	st.(Indentation).SetIndent(5)
+	Restore(st, cp)
+	if st.Pos() != 0 || st.Line() != 1 || st.Column() != 1 || st.(Indentation).Indent() != 3 {
+		t.Fatalf("expect restore to the start but pos %d line %d column %d indent %d",
+			st.Pos(), st.Line(), st.Column(), st.(Indentation).Indent())
+	}
+	if val, _ := GetState(st); val != "start" {
+		t.Fatalf("expect restore the user state but %v", val)
+	}
+	// 只实现 ParseState 的 state 用 SeekTo 回溯
+	plain := struct{ ParseState }{MemoryParseState("abc")}
+	if _, err := Either(Try(String("abd")), String("abc"))(plain); err != nil || plain.Pos() != 3 {
+		t.Fatalf("expect backtrack a state without Checkpointer but pos %d, %v", plain.Pos(), err)
+	}
+}
+
+func TestRunContext(t *testing.T) {
+	ctx := context.Background()
+	val, err := RunContext(ctx, Many(Rune('a')), MemoryParseState("aaa"), Limits{MaxSteps: 10, MaxDepth: 10, MaxInput: 3})
+	if err != nil || len(val.([]interface{})) != 3 {
+		t.Fatalf("expect parse aaa under the limits but %v, %v", val, err)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := RunContext(canceled, Many(Rune('a')), MemoryParseState("aaa"), Limits{}); err == nil {
+		t.Fatalf("expect canceled")
+	} else if e, ok := err.(CanceledError); !ok || e.Err != context.Canceled {
+		t.Fatalf("expect CanceledError but %v", err)
+	}
+
+	data := strings.Repeat("x", 1000)
+	if _, err := RunContext(ctx, ManyTil(AnyRune, String("end")), MemoryParseState(data), Limits{MaxSteps: 100}); err == nil {
+		t.Fatalf("expect step limit")
+	} else if _, ok := err.(StepLimitError); !ok {
+		t.Fatalf("expect StepLimitError but %v", err)
+	}
+	if _, err := RunContext(ctx, TakeWhile(always), MemoryParseState(data), Limits{MaxSteps: 100}); err == nil {
+		t.Fatalf("expect step limit for scanner")
+	} else if _, ok := err.(StepLimitError); !ok {
+		t.Fatalf("expect StepLimitError but %v", err)
+	}
+	// 扫描被限制中断时，TakeUntil 返回的是限制的错误而不是没有找到 s
+	var scanned error
+	until := func(st ParseState) (interface{}, error) {
+		_, scanned = TakeUntil("end")(st)
+		return nil, scanned
+	}
+	if _, err := RunContext(ctx, until, MemoryParseState(data+"end"), Limits{MaxSteps: 100}); err == nil {
+		t.Fatalf("expect step limit for TakeUntil")
+	} else if _, ok := scanned.(StepLimitError); !ok {
+		t.Fatalf("expect TakeUntil returns StepLimitError but %v", scanned)
+	}
+	// ctx 为 nil 时按 context.Background() 处理
+	if val, err := RunContext(nil, Many(Rune('a')), MemoryParseState("aaa"), Limits{}); err != nil || len(val.([]interface{})) != 3 {
+		t.Fatalf("expect parse aaa with a nil context but %v, %v", val, err)
+	}
+
+	var nested Parser
+	nested = func(st ParseState) (interface{}, error) {
+		return Option(nil, Between(Rune('('), Rune(')'), nested))(st)
+	}
+	data = strings.Repeat("(", 10000) + strings.Repeat(")", 10000)
+	if _, err := RunContext(ctx, nested, MemoryParseState(data), Limits{MaxDepth: 100}); err == nil {
+		t.Fatalf("expect depth limit")
+	} else if _, ok := err.(DepthLimitError); !ok {
+		t.Fatalf("expect DepthLimitError but %v", err)
+	}
+
+	if _, err := RunContext(ctx, TakeWhile(always), MemoryParseState("abcd"), Limits{MaxInput: 3}); err == nil {
+		t.Fatalf("expect input limit")
+	} else if _, ok := err.(InputLimitError); !ok {
+		t.Fatalf("expect InputLimitError but %v", err)
+	}
+	if _, err := RunContext(ctx, TakeWhile(always), wrapped{MemoryParseState("abcd")}, Limits{MaxInput: 3}); err == nil {
+		t.Fatalf("expect input limit for stream")
+	} else if _, ok := err.(InputLimitError); !ok {
+		t.Fatalf("expect InputLimitError but %v", err)
+	}
+}
+
+func TestParse(t *testing.T) {
+	word := TakeWhile1(unicode.IsLetter)
+	result, err := Parse(word, "abc")
+	if err != nil || result.Value != "abc" || result.Pos != 3 || result.Column != 4 {
+		t.Fatalf("expect parse abc but %v, %v", result, err)
+	}
+	result, err = Parse(word, "abc def")
+	if e, ok := err.(ParseError); !ok || e.Pos != 3 || result.Pos != 3 {
+		t.Fatalf("expect trailing input error at 3 but %v, %v", result, err)
+	}
+	result, err = Parse(word, "abc def", AllowTrailing())
+	if err != nil || result.Value != "abc" || len(result.Warnings) != 1 || result.Warnings[0].Pos != 3 {
+		t.Fatalf("expect trailing input warning but %v, %v", result, err)
+	}
+	// 回溯的分支中记录的警告会被丢弃
+	warn := func(st ParseState) (interface{}, error) {
+		Warn(st, "deprecated")
+		return nil, nil
+	}
+	result, err = Parse(Either(Try(Bind_(word, Bind_(warn, Rune('!')))), word), "abc")
+	if err != nil || len(result.Warnings) != 0 {
+		t.Fatalf("expect no warnings but %v, %v", result, err)
+	}
+	// 没有消耗输入就失败的分支中记录的警告也会被丢弃
+	result, err = Parse(Either(Bind_(warn, Rune('!')), word), "abc")
+	if err != nil || len(result.Warnings) != 0 {
+		t.Fatalf("expect no warnings from the zero-width branch but %v, %v", result, err)
+	}
+
+	result, err = ParseAll(Bind(word, func(x interface{}) Parser {
+		return Bind_(Option(nil, Rune(' ')), Return(x))
+	}), "ab cd ef")
+	if err != nil || !reflect.DeepEqual(result.Value, []interface{}{"ab", "cd", "ef"}) {
+		t.Fatalf("expect parse all words but %v, %v", result, err)
+	}
+
+	bad := Bind(AnyRune, func(x interface{}) Parser {
+		return Return(x.(string))
+	})
+	result, err = Parse(bad, "a")
+	if e, ok := err.(ParseError); !ok || !strings.HasPrefix(e.Message, "panic:") || result.Pos != 1 {
+		t.Fatalf("expect panic turned into ParseError but %v, %v", result, err)
+	}
+}
+
+func TestPanicFree(t *testing.T) {
+	st := MemoryParseState("abc")
+	AnyRune(st)
+	if err := st.(*StateInMemory).Seek(10); err == nil {
+		t.Fatalf("expect SeekError")
+	} else if e, ok := err.(SeekError); !ok || e.Pos != 10 || e.Size != 3 || st.Pos() != 1 {
+		t.Fatalf("expect SeekError and stay at 1 but %v at %d", err, st.Pos())
+	}
+	if _, err := TryExtractString([]interface{}{'a', "b"}); err == nil {
+		t.Fatalf("expect TypeError")
+	} else if e, ok := err.(TypeError); !ok || e.Type != "rune" {
+		t.Fatalf("expect TypeError but %v", err)
+	}
+	if _, err := Bind(AnyRune, ReturnString)(st); err == nil {
+		t.Fatalf("expect TypeError from ReturnString")
+	} else if e, ok := err.(TypeError); !ok || e.Pos != 2 {
+		t.Fatalf("expect TypeError at 2 but %v", err)
+	}
+	action := Bind(AnyRune, func(x interface{}) Parser {
+		return Return(x.(string))
+	})
+	_, err := Guard(action)(st)
+	if e, ok := err.(ParseError); !ok || e.Pos != 3 || !strings.Contains(e.Stack, "TestPanicFree") {
+		t.Fatalf("expect positioned ParseError with stack but %v", err)
+	}
+}
+
+func TestWhere(t *testing.T) {
+	errTooLarge := errors.New("byte value too large")
+	byteValue := Where(NumberFormat{}.Int64(), func(v interface{}) error {
+		if v.(int64) > 255 {
+			return errTooLarge
+		}
+		return nil
+	})
+	st := MemoryParseState("ip 300")
+	_, err := Bind_(String("ip "), byteValue)(st)
+	if e, ok := err.(ParseError); !ok || e.Pos != 3 || !errors.Is(err, errTooLarge) || st.Pos() != 6 {
+		t.Fatalf("expect error at the integer and stop after it but %v at %d", err, st.Pos())
+	}
+
+	// 标记为可以回溯的错误让 Either 继续尝试其它分支
+	small := Where(NumberFormat{}.Int64(), func(v interface{}) error {
+		if v.(int64) > 9 {
+			return Backtrack(fmt.Errorf("%d is not a digit", v))
+		}
+		return nil
+	})
+	val, err := Either(small, Return("large"))(MemoryParseState("42"))
+	if err != nil || val != "large" {
+		t.Fatalf("expect backtrack to the other branch but %v, %v", val, err)
+	}
+
+	pair := BindE(TakeWhile1(unicode.IsLetter), func(x interface{}) (Parser, error) {
+		if x.(string) == "var" {
+			return nil, fmt.Errorf("%s is reserved", x)
+		}
+		return Return(x), nil
+	})
+	st = MemoryParseState("  var")
+	Spaces(st)
+	_, err = pair(st)
+	if e, ok := err.(ParseError); !ok || e.Pos != 2 || e.Message != "var is reserved" {
+		t.Fatalf("expect error at var but %v", err)
+	}
+
+	// 报告错误时 state 不移动，p 中写入的用户数据和警告都保留
+	st = MemoryParseState("ab")
+	checked := Where(Bind_(Rune('a'), Bind_(PutState(1), Bind_(warnHere, Rune('b')))), func(interface{}) error {
+		return errors.New("rejected")
+	})
+	_, err = checked(st)
+	if e, ok := err.(ParseError); !ok || e.Pos != 0 || e.Column != 1 {
+		t.Fatalf("expect error at the start but %v", err)
+	}
+	if val, _ := GetState(st); st.Pos() != 2 || val != 1 || len(st.(Warnings).Warnings()) != 1 {
+		t.Fatalf("expect stay at 2 with user state and warning but %d, %v, %v", st.Pos(), val,
+			st.(Warnings).Warnings())
+	}
+}
+
+func warnHere(st ParseState) (interface{}, error) {
+	Warn(st, "checked")
+	return nil, nil
+}
+
+func TestTrace(t *testing.T) {
+	var out bytes.Buffer
+	tracer := NewTracer(&out)
+	previous := SetTracer(tracer)
+	defer SetTracer(previous)
+
+	word := Rule("word", TakeWhile1(unicode.IsLetter))
+	number := Rule("number", TakeWhile1(unicode.IsDigit))
+	item := Rule("item", Choice(Try(number), word))
+	if _, err := Many1(Bind(item, func(x interface{}) Parser {
+		return Bind_(Spaces, Return(x))
+	}))(MemoryParseState("ab 12")); err != nil {
+		t.Fatalf("expect parse items but %v", err)
+	}
+	roots := tracer.Roots()
+	if len(roots) != 3 || !roots[0].OK || roots[0].Text != "ab" || roots[2].OK {
+		t.Fatalf("expect three item records but %v", out.String())
+	}
+	if children := roots[0].Children; len(children) != 1 || children[0].Rule != "word" {
+		t.Fatalf("expect Choice skip number and try word but %v", out.String())
+	}
+	expect := "> item at 1:1\n  > word at 1:1\n  < word ok at 1:3 \"ab\"\n< item ok at 1:3 \"ab\"\n"
+	if !strings.HasPrefix(out.String(), expect) {
+		t.Fatalf("expect indented trace\n%s\nbut\n%s", expect, out.String())
+	}
+	var buffer bytes.Buffer
+	if err := tracer.WriteJSON(&buffer); err != nil {
+		t.Fatalf("expect write json but %v", err)
+	}
+	var decoded []*TraceNode
+	if err := json.Unmarshal(buffer.Bytes(), &decoded); err != nil || !reflect.DeepEqual(decoded, roots) {
+		t.Fatalf("expect json round trip but %v", err)
+	}
+
+	// 没有打开全局跟踪时 Trace 只输出，不保留记录
+	SetTracer(nil)
+	var stderr bytes.Buffer
+	traceOutput = &stderr
+	defer func() { traceOutput = os.Stderr }()
+	traced := Trace("word", word)
+	if _, err := traced(MemoryParseState("ab")); err != nil || stderr.Len() == 0 {
+		t.Fatalf("expect trace to the default writer but %v", err)
+	}
+
+	// 同一个 Trace 可以在多个 goroutine 中同时执行
+	traceOutput = io.Discard
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if _, err := traced(MemoryParseState("ab")); err != nil {
+					t.Errorf("expect trace word but %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestProfiler(t *testing.T) {
+	profiler := NewProfiler()
+	profiler.Labels = true
+	previous := SetProfiler(profiler)
+	defer SetProfiler(previous)
+
+	keyword := Rule("keyword", Try(String("let!")))
+	word := Rule("word", TakeWhile1(unicode.IsLetter))
+	item := Rule("item", Either(keyword, word))
+	if _, err := SepBy1(item, Rune(' '))(MemoryParseState("let! lets lettuce")); err != nil {
+		t.Fatalf("expect parse items but %v", err)
+	}
+	stats := map[string]RuleStats{}
+	for _, s := range profiler.Stats() {
+		stats[s.Rule] = s
+	}
+	if s := stats["item"]; s.Calls != 3 || s.Successes != 3 {
+		t.Fatalf("expect item called 3 times but %+v", s)
+	}
+	if s := stats["keyword"]; s.Calls != 3 || s.Successes != 1 || s.Failures != 2 {
+		t.Fatalf("expect keyword fail twice but %+v", s)
+	}
+	if s := stats["word"]; s.Calls != 2 || s.Successes != 2 {
+		t.Fatalf("expect word called twice but %+v", s)
+	}
+	if first := profiler.Stats()[0]; first.Rule != "item" {
+		t.Fatalf("expect item is the slowest rule but %+v", first)
+	}
+	var out bytes.Buffer
+	if err := profiler.WriteReport(&out); err != nil || !strings.Contains(out.String(), "keyword") {
+		t.Fatalf("expect report contains keyword but %v, %s", err, out.String())
+	}
+
+	// 回溯记在发生时最内层的规则上，即使这个规则最终成功了
+	profiler.Reset()
+	pair := Rule("pair", Either(Try(Bind_(word, Rune('!'))), word))
+	if _, err := pair(MemoryParseState("lets")); err != nil {
+		t.Fatalf("expect parse pair but %v", err)
+	}
+	for _, s := range profiler.Stats() {
+		if (s.Rule == "pair" && (s.Successes != 1 || s.Backtrack != 4)) || (s.Rule == "word" && s.Backtrack != 0) {
+			t.Fatalf("expect pair backtrack 4 runes but %+v", s)
+		}
+	}
+
+	// 不带标签时可以被并发的解析共享
+	profiler.Reset()
+	profiler.Labels = false
+	var wg sync.WaitGroup
+	for idx := 0; idx < 4; idx++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			SepBy1(item, Rune(' '))(MemoryParseState("let! lets lettuce"))
+		}()
+	}
+	wg.Wait()
+	for _, s := range profiler.Stats() {
+		if s.Rule == "item" && s.Calls != 12 {
+			t.Fatalf("expect item called 12 times but %+v", s)
+		}
+	}
+}
+
+// recorder 以文本的形式记录 Observer 收到的事件
+type recorder struct {
+	events []string
+}
+
+func (this *recorder) Enter(rule string, pos int) {
+	this.events = append(this.events, fmt.Sprintf("> %s %d", rule, pos))
+}
+
+func (this *recorder) Exit(rule string, pos int, value interface{}, err error) {
+	this.events = append(this.events, fmt.Sprintf("< %s %d %v", rule, pos, err == nil))
+}
+
+func (this *recorder) Backtrack(from, to int) {
+	this.events = append(this.events, fmt.Sprintf("backtrack %d %d", from, to))
+}
+
+func TestObserver(t *testing.T) {
+	keyword := Rule("keyword", Try(Bind_(String("let"), Rune('!'))))
+	word := Rule("word", TakeWhile1(unicode.IsLetter))
+	item := Rule("item", Either(keyword, word))
+
+	rec := &recorder{}
+	if _, err := Parse(item, "lets", WithObserver(rec)); err != nil {
+		t.Fatalf("expect parse lets but %v", err)
+	}
+	expected := []string{
+		"> item 0",
+		"> keyword 0",
+		"backtrack 3 0",
+		"< keyword 0 false",
+		"> word 0",
+		"< word 4 true",
+		"< item 4 true",
+	}
+	if !reflect.DeepEqual(rec.events, expected) {
+		t.Fatalf("expect events %v but %v", expected, rec.events)
+	}
+
+	rec.events = nil
+	small := Rule("small", Where(NumberFormat{}.Int64(), func(v interface{}) error {
+		if v.(int64) > 255 {
+			return Backtrack(fmt.Errorf("%d is too large", v))
+		}
+		return nil
+	}))
+	if _, err := Parse(Either(small, Int), "1024", WithObserver(rec)); err != nil {
+		t.Fatalf("expect parse 1024 but %v", err)
+	}
+	expected = []string{"> small 0", "backtrack 4 0", "< small 0 false"}
+	if !reflect.DeepEqual(rec.events, expected) {
+		t.Fatalf("expect events %v but %v", expected, rec.events)
+	}
+
+	profiler := NewProfiler()
+	other := &recorder{}
+	st := MemoryParseState("let!")
+	st.(Observable).SetObserver(Observers(profiler, other))
+	if _, err := item(st); err != nil {
+		t.Fatalf("expect parse let! but %v", err)
+	}
+	if len(other.events) != 4 {
+		t.Fatalf("expect 4 events but %v", other.events)
+	}
+	if stats := profiler.Stats(); len(stats) != 2 || stats[0].Calls != 1 {
+		t.Fatalf("expect item and keyword called once but %+v", stats)
+	}
+
+	// 规则 panic 被 Guard 恢复以后 Enter 和 Exit 仍然成对
+	rec.events = nil
+	broken := Rule("broken", Bind(AnyRune, func(x interface{}) Parser {
+		return Return(x.(string))
+	}))
+	if _, err := Parse(Guard(Rule("outer", broken)), "x", WithObserver(rec)); err == nil {
+		t.Fatalf("expect the panic turned into an error")
+	}
+	expected = []string{"> outer 0", "> broken 0", "< broken 1 false", "< outer 1 false"}
+	if !reflect.DeepEqual(rec.events, expected) {
+		t.Fatalf("expect events %v but %v", expected, rec.events)
+	}
+}
+
+func TestCoverage(t *testing.T) {
+	keyword := Rule("keyword", Try(String("let!")))
+	word := Rule("word", TakeWhile1(unicode.IsLetter))
+	number := Rule("number", TakeWhile1(unicode.IsDigit))
+	item := Rule("item", Choice(keyword, word, number))
+	items := Rule("items", SepBy1(Either(item, String("-")), Rune(' ')))
+
+	cov := NewCoverage(items)
+	if _, err := Parse(items, "let! lets - go", WithObserver(cov)); err != nil {
+		t.Fatalf("expect parse items but %v", err)
+	}
+	expected := []string{"rule number", "item: choice#0 branch 2 (number)"}
+	if uncovered := cov.Uncovered(); !reflect.DeepEqual(uncovered, expected) {
+		t.Fatalf("expect uncovered %v but %v", expected, uncovered)
+	}
+	branches := cov.Branches()
+	if len(branches) != 5 || branches[0].Rule != "items" || branches[0].Hits != 3 || branches[3].Hits != 2 {
+		t.Fatalf("expect either and choice branches counted but %+v", branches)
+	}
+
+	var report bytes.Buffer
+	cov.WriteReport(&report)
+	if !strings.HasPrefix(report.String(), "rules: 4/5 covered, branches: 4/5 covered\n") {
+		t.Fatalf("unexpected report %s", report.String())
+	}
+	var page bytes.Buffer
+	if err := cov.WriteHTML(&page); err != nil || !strings.Contains(page.String(), `<tr class="uncovered"><td>number</td>`) {
+		t.Fatalf("expect html marks number uncovered but %v, %s", err, page.String())
+	}
+
+	// Cover 全局收集覆盖情况，不需要挂载到 state 上
+	global := Cover(t, items)
+	items(MemoryParseState("42"))
+	if rules := global.Rules(); rules[len(rules)-1].Rule != "number" || rules[len(rules)-1].Hits != 1 {
+		t.Fatalf("expect number covered but %+v", rules)
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	opaque := func(st ParseState) (interface{}, error) {
+		r, _, err := st.Next(always)
+		return r, err
+	}
+	p := Rule("item", Choice(String("let"), NoneOf("ab"), Keywords("in", "int"), opaque))
+	n := Describe(p)
+	if n == nil || n.Kind != "rule" || n.Label != "item" {
+		t.Fatalf("expect rule item but %+v", n)
+	}
+	choice := Describe(n.Children[0])
+	if choice.Kind != "choice" || len(choice.Children) != 4 {
+		t.Fatalf("expect choice of 4 branches but %+v", choice)
+	}
+	if s := Describe(choice.Children[0]); s.Kind != "string" || !reflect.DeepEqual(s.Literals, []string{"let"}) {
+		t.Fatalf("expect string literal let but %+v", s)
+	}
+	if s := Describe(choice.Children[1]); !s.Negated || !reflect.DeepEqual(s.Literals, []string{"a", "b"}) {
+		t.Fatalf("expect negated set of a and b but %+v", s)
+	}
+	if s := Describe(choice.Children[2]); !reflect.DeepEqual(s.Literals, []string{"in", "int"}) {
+		t.Fatalf("expect keywords in and int but %+v", s)
+	}
+	if s := Describe(choice.Children[3]); s != nil {
+		t.Fatalf("expect opaque parser has no description but %+v", s)
+	}
+	if Describe(p) != n {
+		t.Fatalf("expect the same node for the same parser")
+	}
+
+	// 调用库内 parser 的包装函数也是不透明的，不会被描述成它调用的 parser
+	wrapper := func(st ParseState) (interface{}, error) {
+		return String("let")(st)
+	}
+	if s := Describe(wrapper); s != nil {
+		t.Fatalf("expect wrapper has no description but %+v", s)
+	}
+	var out bytes.Buffer
+	if err := WriteEBNF(&out, Rule("let", Bind_(wrapper, Rune('=')))); err != nil {
+		t.Fatalf("expect write ebnf but %v", err)
+	}
+	if expected := "let ::= /* opaque */ \"=\"\n"; out.String() != expected {
+		t.Fatalf("expect ebnf %q but %q", expected, out.String())
+	}
+}
+
+func TestLazy(t *testing.T) {
+	var expr Parser
+	number := TakeWhile1(unicode.IsDigit)
+	term := Either(number, Between(Rune('('), Rune(')'), Lazy(func() Parser { return expr })))
+	expr = Rule("expr", SepBy1(term, Rune('+')))
+	if err := Validate(expr); err != nil {
+		t.Fatalf("expect the grammar is valid but %v", err)
+	}
+	if _, err := Parse(expr, "1+(2+(3))"); err != nil {
+		t.Fatalf("expect parse nested expression but %v", err)
+	}
+	accept, empty, known := First(expr)
+	if !known || empty || !accept('(') || !accept('7') || accept('+') {
+		t.Fatalf("expect expr starts with digit or ( but %v %v", empty, known)
+	}
+	if empty, known := Nullable(Many(expr)); !empty || !known {
+		t.Fatalf("expect Many(expr) is nullable")
+	}
+
+	var left Parser
+	left = Rule("sum", Either(Bind_(Lazy(func() Parser { return left }), Rune('+')), number))
+	err := Validate(left)
+	if err == nil || !strings.Contains(err.Error(), "sum -> either -> bind_ -> lazy -> sum: left recursion") {
+		t.Fatalf("expect left recursion reported but %v", err)
+	}
+}
+
+func TestEBNF(t *testing.T) {
+	var expr Parser
+	number := Rule("number", Bind_(Option(nil, Rune('-')), Many1(Digit)))
+	term := Rule("term", Either(number, Between(Rune('('), Rune(')'), Lazy(func() Parser { return expr }))))
+	expr = Rule("expr", SepBy1(term, OneOf("+-")))
+	statement := Bind_(Keywords("let", "var"), Bind_(Skip(Space), expr))
+
+	var out bytes.Buffer
+	if err := WriteEBNF(&out, statement); err != nil {
+		t.Fatalf("expect write ebnf but %v", err)
+	}
+	expected := `grammar ::= ("let" | "var") /* space */* expr
+expr    ::= term ([+#x2D] term)*
+term    ::= number
+          | "(" expr ")"
+number  ::= "-"? /* digit */+
+`
+	if out.String() != expected {
+		t.Fatalf("expect ebnf\n%s\nbut\n%s", expected, out.String())
+	}
+
+	// Bind 的后继和 Expect 的描述写成注释
+	out.Reset()
+	name := Rule("name", Bind(Expect("identifier", TakeWhile1(unicode.IsLetter)), func(x interface{}) Parser {
+		return Return(strings.ToUpper(x.(string)))
+	}))
+	if err := WriteEBNF(&out, Bind_(GoString, name)); err != nil {
+		t.Fatalf("expect write ebnf but %v", err)
+	}
+	expected = "grammar ::= /* string literal \"…\" or `…` */ name\nname    ::= /* identifier */ /* … */\n"
+	if out.String() != expected {
+		t.Fatalf("expect ebnf\n%s\nbut\n%s", expected, out.String())
+	}
+
+	var svg bytes.Buffer
+	if err := WriteRailroadSVG(&svg, expr); err != nil {
+		t.Fatalf("expect write svg but %v", err)
+	}
+	decoder := xml.NewDecoder(&svg)
+	ids := []string{}
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("expect well-formed svg but %v", err)
+		}
+		if start, ok := token.(xml.StartElement); ok && start.Name.Local == "g" {
+			for _, attr := range start.Attr {
+				if attr.Name.Local == "id" {
+					ids = append(ids, attr.Value)
+				}
+			}
+		}
+	}
+	if !reflect.DeepEqual(ids, []string{"expr", "term", "number"}) {
+		t.Fatalf("expect diagrams of expr, term and number but %v", ids)
+	}
+
+	var page bytes.Buffer
+	if err := WriteRailroadHTML(&page, "expression", expr); err != nil {
+		t.Fatalf("expect write html but %v", err)
+	}
+	html := page.String()
+	if strings.Count(html, "<svg") != 3 || !strings.Contains(html, `<a href="#term">`) ||
+		strings.Contains(html, "<script") {
+		t.Fatalf("expect a self-contained page with linked diagrams but\n%s", html)
+	}
+}
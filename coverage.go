@@ -0,0 +1,276 @@
+package goparsec
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+	"sync"
+)
+
+// RuleCoverage 是一个命名规则的覆盖情况，Hits 是它成功的次数
+type RuleCoverage struct {
+	Rule string
+	Hits int
+}
+
+// BranchCoverage 是 Choice 或 Either 的一个分支的覆盖情况，Hits 是它成功的次数
+type BranchCoverage struct {
+	// Rule 是分支所在的命名规则，不在任何命名规则中时为空
+	Rule string
+	// Kind 是 "choice" 或 "either" ，Group 是它在 Rule 中的序号，从 0 开始
+	Kind  string
+	Group int
+	// Index 是分支的序号，从 0 开始，Label 描述分支的内容
+	Index int
+	Label string
+	Hits  int
+}
+
+func (this BranchCoverage) String() string {
+	rule := this.Rule
+	if rule == "" {
+		rule = "<top>"
+	}
+	return fmt.Sprintf("%s: %s#%d branch %d (%s)", rule, this.Kind, this.Group, this.Index, this.Label)
+}
+
+// Coverage 记录 grammar 中哪些命名规则和 Choice 、Either 的分支成功过。分支在创建时
+// 从 grammar 中静态地收集，经由不透明的 parser 才能到达的分支无法收集，也不会记录。
+// Coverage 实现了 Observer ，可以挂载到 state 上，也可以用 SetObserver 或者 Cover
+// 全局使用。
+type Coverage struct {
+	mu       sync.Mutex
+	rules    []*RuleCoverage
+	named    map[string]*RuleCoverage
+	branches []*BranchCoverage
+	groups   map[*Node][]*BranchCoverage
+}
+
+// NewCoverage 收集 grammar 中的命名规则和分支
+func NewCoverage(grammar ...Parser) *Coverage {
+	cov := &Coverage{
+		named:  map[string]*RuleCoverage{},
+		groups: map[*Node][]*BranchCoverage{},
+	}
+	visited := map[*Node]bool{}
+	counts := map[string]int{}
+	var walk func(p Parser, rule string, depth int)
+	walk = func(p Parser, rule string, depth int) {
+		if depth > maxProbeDepth {
+			return
+		}
+		n := Describe(p)
+		if n == nil || visited[n] {
+			return
+		}
+		visited[n] = true
+		switch n.Kind {
+		case "rule":
+			rule = n.Label
+			cov.rule(rule)
+		case "choice", "either":
+			group := counts[rule]
+			counts[rule]++
+			for idx, child := range n.Children {
+				b := &BranchCoverage{Rule: rule, Kind: n.Kind, Group: group, Index: idx,
+					Label: branchLabel(child)}
+				cov.branches = append(cov.branches, b)
+				cov.groups[n] = append(cov.groups[n], b)
+			}
+		}
+		for _, child := range n.Children {
+			walk(child, rule, depth+1)
+		}
+	}
+	for _, p := range grammar {
+		walk(p, "", 0)
+	}
+	return cov
+}
+
+// branchLabel 描述一个分支，命名规则使用它的名字，有期望输入的描述时使用描述，其它的
+// 使用组合子的种类
+func branchLabel(p Parser) string {
+	n := Describe(p)
+	switch {
+	case n == nil:
+		return "opaque"
+	case n.Label != "":
+		return n.Label
+	case n.Expected != "":
+		return n.Expected
+	default:
+		return n.Kind
+	}
+}
+
+// rule 返回 name 的覆盖记录，没有时创建
+func (this *Coverage) rule(name string) *RuleCoverage {
+	r, ok := this.named[name]
+	if !ok {
+		r = &RuleCoverage{Rule: name}
+		this.named[name] = r
+		this.rules = append(this.rules, r)
+	}
+	return r
+}
+
+// Enter 实现 Observer ，不做记录
+func (this *Coverage) Enter(rule string, pos int) {}
+
+// Exit 实现 Observer ，记录成功的规则
+func (this *Coverage) Exit(rule string, pos int, value interface{}, err error) {
+	if err != nil {
+		return
+	}
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.rule(rule).Hits++
+}
+
+// Backtrack 实现 Observer ，不做记录
+func (this *Coverage) Backtrack(from, to int) {}
+
+func (this *Coverage) branch(n *Node, idx int) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if branches, ok := this.groups[n]; ok && idx < len(branches) {
+		branches[idx].Hits++
+	}
+}
+
+// Rules 返回所有命名规则的覆盖情况，按照在 grammar 中出现的顺序排列
+func (this *Coverage) Rules() []RuleCoverage {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	ret := make([]RuleCoverage, len(this.rules))
+	for idx, r := range this.rules {
+		ret[idx] = *r
+	}
+	return ret
+}
+
+// Branches 返回所有分支的覆盖情况，按照在 grammar 中出现的顺序排列
+func (this *Coverage) Branches() []BranchCoverage {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	ret := make([]BranchCoverage, len(this.branches))
+	for idx, b := range this.branches {
+		ret[idx] = *b
+	}
+	return ret
+}
+
+// Uncovered 返回没有成功过的规则和分支的描述，全部覆盖时返回空
+func (this *Coverage) Uncovered() []string {
+	ret := []string{}
+	for _, r := range this.Rules() {
+		if r.Hits == 0 {
+			ret = append(ret, fmt.Sprintf("rule %s", r.Rule))
+		}
+	}
+	for _, b := range this.Branches() {
+		if b.Hits == 0 {
+			ret = append(ret, b.String())
+		}
+	}
+	return ret
+}
+
+// WriteReport 把覆盖率和没有覆盖的规则、分支以文本的形式写到 w
+func (this *Coverage) WriteReport(w io.Writer) error {
+	rules, branches := this.Rules(), this.Branches()
+	coveredRules, coveredBranches := 0, 0
+	for _, r := range rules {
+		if r.Hits > 0 {
+			coveredRules++
+		}
+	}
+	for _, b := range branches {
+		if b.Hits > 0 {
+			coveredBranches++
+		}
+	}
+	_, err := fmt.Fprintf(w, "rules: %d/%d covered, branches: %d/%d covered\n",
+		coveredRules, len(rules), coveredBranches, len(branches))
+	if err != nil {
+		return err
+	}
+	for _, line := range this.Uncovered() {
+		if _, err := fmt.Fprintf(w, "  uncovered %s\n", line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var coverageHTML = template.Must(template.New("coverage").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>grammar coverage</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 2px 8px; text-align: left; }
+.covered { background: #dfd; }
+.uncovered { background: #fdd; }
+</style>
+</head>
+<body>
+<h1>grammar coverage</h1>
+<h2>rules</h2>
+<table>
+<tr><th>rule</th><th>hits</th></tr>
+{{range .Rules}}<tr class="{{if .Hits}}covered{{else}}uncovered{{end}}"><td>{{.Rule}}</td><td>{{.Hits}}</td></tr>
+{{end}}</table>
+<h2>branches</h2>
+<table>
+<tr><th>rule</th><th>combinator</th><th>branch</th><th>label</th><th>hits</th></tr>
+{{range .Branches}}<tr class="{{if .Hits}}covered{{else}}uncovered{{end}}"><td>{{.Rule}}</td><td>{{.Kind}}#{{.Group}}</td><td>{{.Index}}</td><td>{{.Label}}</td><td>{{.Hits}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// WriteHTML 把覆盖情况写成一个独立的 HTML 页面，没有覆盖的规则和分支标为红色
+func (this *Coverage) WriteHTML(w io.Writer) error {
+	return coverageHTML.Execute(w, struct {
+		Rules    []RuleCoverage
+		Branches []BranchCoverage
+	}{this.Rules(), this.Branches()})
+}
+
+// TB 是 Cover 需要的 *testing.T 和 *testing.B 的方法
+type TB interface {
+	Helper()
+	Cleanup(func())
+	Logf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+// Cover 在测试期间全局收集 grammar 的覆盖情况，测试结束时用 t.Logf 输出覆盖报告。
+// 需要全部覆盖时在测试的最后调用 Require 。Cover 用 SetObserver 安装全局的 observer ，
+// 测试期间所有 goroutine 的解析都会计入覆盖情况，所以使用 Cover 的测试不能调用
+// t.Parallel ，也不能与其它调用了 t.Parallel 的解析测试同时执行。
+func Cover(t TB, grammar ...Parser) *Coverage {
+	t.Helper()
+	cov := NewCoverage(grammar...)
+	previous := SetObserver(cov)
+	t.Cleanup(func() {
+		SetObserver(previous)
+		var report strings.Builder
+		cov.WriteReport(&report)
+		t.Logf("grammar coverage:\n%s", report.String())
+	})
+	return cov
+}
+
+// Require 在有没有覆盖的规则或分支时用 t.Errorf 报告测试失败
+func (this *Coverage) Require(t TB) {
+	t.Helper()
+	if uncovered := this.Uncovered(); len(uncovered) > 0 {
+		t.Errorf("grammar is not fully covered:\n  %s", strings.Join(uncovered, "\n  "))
+	}
+}
@@ -0,0 +1,301 @@
+package goparsec
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// syntax 是导出 grammar 时使用的表达式，由 Node 转换而来
+type syntax struct {
+	// kind 是 "seq" 、"alt" 、"opt" 、"star" 、"plus" 、"literal" 、"class" 、"ref" 、
+	// "comment" 或 "empty"
+	kind  string
+	items []*syntax
+	// text 是 literal 的字面量、ref 的规则名、comment 的内容，或者 class 的字符集合
+	text    string
+	negated bool
+}
+
+// grammarRule 是导出的一条命名规则
+type grammarRule struct {
+	name string
+	body *syntax
+}
+
+// silentKinds 中的组合子不消耗输入，也不影响 grammar 的形状，导出时省略
+var silentKinds = map[string]bool{
+	"return":      true,
+	"getState":    true,
+	"putState":    true,
+	"modifyState": true,
+}
+
+// exporter 从 start 开始收集所有能够到达的命名规则
+type exporter struct {
+	rules   []grammarRule
+	defined map[string]bool
+	pending []*Node
+}
+
+// collectRules 把 start 和它引用的命名规则转换为 syntax ，start 没有命名时叫做 grammar 。
+// 同名的规则只导出第一次遇到的那一个。
+func collectRules(start Parser) []grammarRule {
+	this := &exporter{defined: map[string]bool{}}
+	if n := Describe(start); n != nil && n.Kind == "rule" {
+		this.defined[n.Label] = true
+		this.pending = append(this.pending, n)
+	} else {
+		this.defined["grammar"] = true
+		this.rules = append(this.rules, grammarRule{"grammar", this.convert(start, nil)})
+	}
+	for len(this.pending) > 0 {
+		n := this.pending[0]
+		this.pending = this.pending[1:]
+		this.rules = append(this.rules, grammarRule{n.Label, this.convert(n.Children[0], nil)})
+	}
+	return this.rules
+}
+
+func (this *exporter) convert(p Parser, path []*Node) *syntax {
+	n := Describe(p)
+	switch {
+	case n == nil:
+		return &syntax{kind: "comment", text: "opaque"}
+	case n.Kind == "rule":
+		if !this.defined[n.Label] {
+			this.defined[n.Label] = true
+			this.pending = append(this.pending, n)
+		}
+		return &syntax{kind: "ref", text: n.Label}
+	case onPath(path, n) || len(path) > maxProbeDepth:
+		// 没有命名的递归无法展开
+		return &syntax{kind: "comment", text: "recursion"}
+	}
+	path = append(path, n)
+	children := func() []*syntax {
+		items := []*syntax{}
+		for _, child := range n.Children {
+			items = append(items, this.convert(child, path))
+		}
+		return items
+	}
+	switch n.Kind {
+	case "try", "span", "withPos", "lineFold", "guard", "where", "lazy":
+		return this.convert(n.Children[0], path)
+	case "bind":
+		// Bind 的后继要到运行时才能得到，写成注释
+		return sequence([]*syntax{this.convert(n.Children[0], path), {kind: "comment", text: "…"}})
+	case "expect":
+		return &syntax{kind: "comment", text: n.Expected}
+	case "bind_", "between", "union", "unionAll":
+		return sequence(children())
+	case "either", "choice":
+		return alternative(children())
+	case "option":
+		return &syntax{kind: "opt", items: children()}
+	case "many", "skip":
+		return &syntax{kind: "star", items: children()}
+	case "many1", "block":
+		return &syntax{kind: "plus", items: children()}
+	case "sepBy1":
+		items := children()
+		repeat := sequence([]*syntax{items[1], items[0]})
+		return sequence([]*syntax{items[0], {kind: "star", items: []*syntax{repeat}}})
+	case "manyTil":
+		items := children()
+		return sequence([]*syntax{{kind: "star", items: items[:1]}, items[1]})
+	case "string", "rune":
+		return &syntax{kind: "literal", text: n.Literals[0]}
+	case "stringFold":
+		return sequence([]*syntax{
+			{kind: "literal", text: n.Literals[0]},
+			{kind: "comment", text: "case-insensitive"},
+		})
+	case "oneOf", "noneOf":
+		return &syntax{kind: "class", text: strings.Join(n.Literals, ""), negated: n.Negated}
+	case "keywords":
+		items := []*syntax{}
+		for _, word := range n.Literals {
+			items = append(items, &syntax{kind: "literal", text: word})
+		}
+		return alternative(items)
+	default:
+		if silentKinds[n.Kind] {
+			return &syntax{kind: "empty"}
+		}
+		if n.Expected != "" {
+			return &syntax{kind: "comment", text: n.Expected}
+		}
+		return &syntax{kind: "comment", text: n.Kind}
+	}
+}
+
+// sequence 构造顺序匹配的表达式，展开嵌套的 seq ，去掉 empty
+func sequence(items []*syntax) *syntax {
+	flat := []*syntax{}
+	for _, item := range items {
+		switch item.kind {
+		case "seq":
+			flat = append(flat, item.items...)
+		case "empty":
+		default:
+			flat = append(flat, item)
+		}
+	}
+	switch len(flat) {
+	case 0:
+		return &syntax{kind: "empty"}
+	case 1:
+		return flat[0]
+	default:
+		return &syntax{kind: "seq", items: flat}
+	}
+}
+
+// alternative 构造选择的表达式，展开嵌套的 alt ，有 empty 的分支时转换为 opt
+func alternative(items []*syntax) *syntax {
+	flat := []*syntax{}
+	optional := false
+	for _, item := range items {
+		switch item.kind {
+		case "alt":
+			flat = append(flat, item.items...)
+		case "empty":
+			optional = true
+		default:
+			flat = append(flat, item)
+		}
+	}
+	var ret *syntax
+	switch len(flat) {
+	case 0:
+		return &syntax{kind: "empty"}
+	case 1:
+		ret = flat[0]
+	default:
+		ret = &syntax{kind: "alt", items: flat}
+	}
+	if optional {
+		return &syntax{kind: "opt", items: []*syntax{ret}}
+	}
+	return ret
+}
+
+// ebnfChar 把不能直接写在引号或字符集合中的字符写成 #xN
+func ebnfChar(r rune) string {
+	return fmt.Sprintf("#x%X", r)
+}
+
+// ebnfLiteral 把 s 写成 W3C EBNF 的字符串，控制字符和同时出现的两种引号写成 #xN
+func ebnfLiteral(s string) string {
+	quote := "\""
+	if strings.Contains(s, "\"") {
+		quote = "'"
+	}
+	parts := []string{}
+	current := []rune{}
+	flush := func() {
+		if len(current) > 0 {
+			parts = append(parts, quote+string(current)+quote)
+			current = current[:0]
+		}
+	}
+	for _, r := range s {
+		if !unicode.IsPrint(r) || string(r) == quote {
+			flush()
+			parts = append(parts, ebnfChar(r))
+		} else {
+			current = append(current, r)
+		}
+	}
+	flush()
+	if len(parts) == 0 {
+		return "\"\""
+	}
+	return strings.Join(parts, " ")
+}
+
+// ebnfClass 把字符集合写成 W3C EBNF 的 [...] 或 [^...]
+func ebnfClass(set string, negated bool) string {
+	var buf strings.Builder
+	buf.WriteString("[")
+	if negated {
+		buf.WriteString("^")
+	}
+	for _, r := range set {
+		if !unicode.IsPrint(r) || strings.ContainsRune("]^-", r) {
+			buf.WriteString(ebnfChar(r))
+		} else {
+			buf.WriteRune(r)
+		}
+	}
+	buf.WriteString("]")
+	return buf.String()
+}
+
+// ebnf 把表达式写成 W3C EBNF ，outer 是外层表达式的种类，用来决定是否需要括号
+func (this *syntax) ebnf(outer string) string {
+	switch this.kind {
+	case "literal":
+		return ebnfLiteral(this.text)
+	case "class":
+		return ebnfClass(this.text, this.negated)
+	case "ref":
+		return this.text
+	case "comment":
+		return "/* " + this.text + " */"
+	case "empty":
+		return "/* empty */"
+	case "opt", "star", "plus":
+		suffix := map[string]string{"opt": "?", "star": "*", "plus": "+"}[this.kind]
+		return this.items[0].ebnf("postfix") + suffix
+	}
+	parts := []string{}
+	separator := " "
+	if this.kind == "alt" {
+		separator = " | "
+	}
+	for _, item := range this.items {
+		parts = append(parts, item.ebnf(this.kind))
+	}
+	text := strings.Join(parts, separator)
+	if outer == "postfix" || (outer == "seq" && this.kind == "alt") {
+		return "(" + text + ")"
+	}
+	return text
+}
+
+// WriteEBNF 把从 start 开始能够到达的命名规则写成 W3C EBNF ，每条规则一行，最外层的
+// 选择分多行对齐书写。start 本身没有命名时作为 grammar 规则。用户写的 parser 即使内部
+// 调用了库内的 parser 也是不透明的，写成 /* opaque */ ；无法用 EBNF 表达的 parser （例如
+// TakeWhile 的条件）写成注释。有 Expect 的描述时使用描述，Bind 的后继写成 /* … */ 。
+func WriteEBNF(w io.Writer, start Parser) error {
+	return writeEBNF(w, collectRules(start))
+}
+
+func writeEBNF(w io.Writer, rules []grammarRule) error {
+	width := 0
+	for _, rule := range rules {
+		if len(rule.name) > width {
+			width = len(rule.name)
+		}
+	}
+	for _, rule := range rules {
+		var text string
+		if rule.body.kind == "alt" {
+			parts := []string{}
+			for _, item := range rule.body.items {
+				parts = append(parts, item.ebnf(""))
+			}
+			text = strings.Join(parts, "\n"+strings.Repeat(" ", width)+"   | ")
+		} else {
+			text = rule.body.ebnf("")
+		}
+		if _, err := fmt.Fprintf(w, "%-*s ::= %s\n", width, rule.name, text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -2,10 +2,12 @@ package main
 
 //gisp is a go parsec example, create a shceme like parser. you can run the interpreter though
 //    go run gisp
+//run it with -ebnf or -railroad to print the grammar as W3C EBNF or as an HTML page of railroad diagrams
 
 import (
 	"bufio"
 	"fmt"
+	"github.com/Dwarfartisan/goparsec"
 	"github.com/Dwarfartisan/goparsec/examples/gisp"
 	"os"
 )
@@ -13,6 +15,16 @@ import (
 var prompt = ">>> "
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "-ebnf":
+			goparsec.WriteEBNF(os.Stdout, gisp.Grammar())
+			return
+		case "-railroad":
+			goparsec.WriteRailroadHTML(os.Stdout, "gisp", gisp.Grammar())
+			return
+		}
+	}
 	interactive()
 }
 
@@ -3,8 +3,6 @@ package gisp
 import (
 	"fmt"
 	. "github.com/Dwarfartisan/goparsec"
-	"reflect"
-	"unicode"
 )
 
 type Atom struct {
@@ -23,12 +21,21 @@ func (this Atom) Eval(env Env) (interface{}, error) {
 	}
 }
 
+var atomExcludes = NewRuneSet("'() \t\r\n.")
+
+func isAtomRune(r rune) bool {
+	return !atomExcludes.Contains(r)
+}
+
+var atomName = Expect("atom name", TakeWhile1(isAtomRune))
+
+var atomParser = Bind(atomName, func(a interface{}) Parser {
+	return Return(Atom{a.(string)})
+})
+
+// atomRule 是 grammar 中命名的 atom 规则，value 和 list 都引用它
+var atomRule = Rule("atom", atomParser)
+
 func AtomParser(st ParseState) (interface{}, error) {
-	a, err := Bind(Many1(NoneOf("'() \t\r\n.")),
-		ReturnString)(st)
-	if err == nil {
-		return Atom{a.(string)}, nil
-	} else {
-		return nil, err
-	}
+	return atomParser(st)
 }
@@ -0,0 +1,58 @@
+package gisp
+
+import (
+	. "github.com/Dwarfartisan/goparsec"
+	"strings"
+	"testing"
+)
+
+const benchCode = `(var greeting "hello world") (quote (foo bar baz 1.5 42 true nil)) (+ 1 2 3)`
+
+// atomIndexRune 是 AtomParser 原来的实现方式，用于和 RuneSet 版本对比
+func atomIndexRune(st ParseState) (interface{}, error) {
+	noneOf := func(runes string) Parser {
+		return RuneChecker(func(ru rune) bool { return strings.IndexRune(runes, ru) < 0 }, runes)
+	}
+	a, err := Bind(Many1(noneOf("'() \t\r\n.")), ReturnString)(st)
+	if err == nil {
+		return Atom{a.(string)}, nil
+	} else {
+		return nil, err
+	}
+}
+
+func benchmarkBody(b *testing.B, value Parser) {
+	body := SepBy(value, Many1(Space))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := body(MemoryParseState(benchCode)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkValueParser(b *testing.B) {
+	benchmarkBody(b, ValueParser)
+}
+
+func BenchmarkAtomIndexRune(b *testing.B) {
+	atoms := strings.TrimSpace(strings.Repeat("lambda define quote ", 20))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		st := MemoryParseState(atoms)
+		if _, err := SepBy(atomIndexRune, Many1(Space))(st); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkAtomRuneSet(b *testing.B) {
+	atoms := strings.TrimSpace(strings.Repeat("lambda define quote ", 20))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		st := MemoryParseState(atoms)
+		if _, err := SepBy(AtomParser, Many1(Space))(st); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -5,7 +5,8 @@ import (
 	. "github.com/Dwarfartisan/goparsec"
 )
 
-var BoolParser = Bind(Choice(String("true"), String("false")), func(input interface{}) Parser {
+// 关键字之后紧跟 atom 的字符时不是 bool 值，例如 trueish 是一个 atom
+var BoolParser = Bind(KeywordsBounded(isAtomRune, "true", "false"), func(input interface{}) Parser {
 	return func(st ParseState) (interface{}, error) {
 		switch input.(string) {
 		case "true":
@@ -107,22 +107,22 @@ func (this List) Eval(env Env) (interface{}, error) {
 	}
 }
 
-func bodyParser(st ParseState) (interface{}, error) {
-	value, err := SepBy(ValueParser, Many1(Space))(st)
-	return value, err
-}
+// value 通过 Lazy 引用递归的 valueParser ，grammar 仍然可以被 Describe 分析
+var value = Lazy(func() Parser { return valueParser })
+
+var bodyParser = SepBy(value, Many1(Space))
+
+var oneAtom = Bind(atomRule, func(atom interface{}) Parser {
+	return Return([]interface{}{atom})
+})
+
+var listParser = Bind(Either(Try(Between(Rune('('), Rune(')'), oneAtom)),
+	Between(Rune('('), Rune(')'), bodyParser)), func(list interface{}) Parser {
+	return Return(List(list.([]interface{})))
+})
 
 func ListParser(st ParseState) (interface{}, error) {
-	one := Bind(AtomParser, func(atom interface{}) Parser {
-		return Bind_(Rune(')'), Return(List{atom}))
-	})
-	list, err := Either(Try(Bind_(Rune('('), one)),
-		Between(Rune('('), Rune(')'), bodyParser))(st)
-	if err == nil {
-		return List(list.([]interface{})), nil
-	} else {
-		return nil, err
-	}
+	return listParser(st)
 }
 
 type Quote struct {
@@ -133,25 +133,36 @@ func (this Quote) Eval(env Env) (interface{}, error) {
 	return this.Lisp, nil
 }
 
+var quoteParser = Bind(Bind_(Rune('\''), value), func(lisp interface{}) Parser {
+	return Return(Quote{lisp})
+})
+
 func QuoteParser(st ParseState) (interface{}, error) {
-	lisp, err := Bind_(Rune('\''), ValueParser)(st)
-	if err == nil {
-		return Quote{lisp}, nil
-	} else {
-		return nil, err
-	}
+	return quoteParser(st)
+}
+
+// valueParser 只构造一次，Choice 在第一次执行时会分析各个分支的首字符
+var valueParser Parser
+
+func init() {
+	valueParser = Rule("value", Choice(Rule("string", StringParser),
+		Rule("number", numberParser),
+		Rule("rune", Try(RuneParser)),
+		Rule("quote", quoteParser),
+		Rule("string", StringParser),
+		Rule("bool", BoolParser),
+		Rule("nil", NilParser),
+		atomRule,
+		Rule("list", listParser)))
+}
+
+// Grammar 返回 gisp 值的 grammar ，可以用 WriteEBNF 或 WriteRailroadHTML 生成文档
+func Grammar() Parser {
+	return valueParser
 }
 
 func ValueParser(st ParseState) (interface{}, error) {
-	value, err := Choice(StringParser,
-		NumberParser,
-		QuoteParser,
-		RuneParser,
-		StringParser,
-		BoolParser,
-		NilParser,
-		AtomParser,
-		ListParser)(st)
+	value, err := valueParser(st)
 	return value, err
 }
 
@@ -217,14 +228,13 @@ func (this GispParser) Global(name string) (interface{}, bool) {
 	return nil, false
 }
 
+// Parse 解析并求值 code 中的一个表达式，表达式前后可以有空白，之后不能有其它内容
 func (this GispParser) Parse(code string) (interface{}, error) {
-	st := MemoryParseState(code)
-
-	value, err := ValueParser(st)
+	result, err := Parse(Between(Spaces, Spaces, ValueParser), code)
 	if err != nil {
 		return nil, err
 	}
-	switch lisp := value.(type) {
+	switch lisp := result.Value.(type) {
 	case Lisp:
 		return lisp.Eval(this)
 	default:
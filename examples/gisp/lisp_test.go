@@ -0,0 +1,111 @@
+package gisp
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	. "github.com/Dwarfartisan/goparsec"
+)
+
+func TestParseRequiresEof(t *testing.T) {
+	gisp, err := NewGisp(map[string]Environment{"axiom": Axiom, "prop": Propositions})
+	if err != nil {
+		t.Fatalf("expect create gisp but %v", err)
+	}
+	if _, err := gisp.Parse("1 garbage"); err == nil {
+		t.Fatalf("expect error for trailing garbage")
+	}
+	val, err := gisp.Parse(" (+ 1 2 3) ")
+	if err != nil || fmt.Sprint(val) != "6" {
+		t.Fatalf("expect 6 but %v, %v", val, err)
+	}
+}
+
+func TestValueCoverage(t *testing.T) {
+	cov := Cover(t, valueParser)
+	for _, code := range []string{`"text"`, "3.14", "-2.5", "-2", "'a'", "'a", "true", "nil", "(foo)", "(+ 1 2)"} {
+		if _, err := Parse(valueParser, code); err != nil {
+			t.Fatalf("expect parse %s but %v", code, err)
+		}
+	}
+	if result, err := Parse(valueParser, "'a'"); err != nil || result.Value != "a" {
+		t.Fatalf("expect rune literal 'a' but %v, %v", result, err)
+	}
+	// StringParser 在 Choice 中出现了两次，第二次永远不会被选中
+	expected := []string{
+		"value: choice#0 branch 4 (string)",
+	}
+	if uncovered := cov.Uncovered(); !reflect.DeepEqual(uncovered, expected) {
+		t.Fatalf("expect uncovered %v but %v", expected, uncovered)
+	}
+}
+
+func TestSingleAtomList(t *testing.T) {
+	val, err := ListParser(MemoryParseState("(foo)"))
+	if err != nil || !reflect.DeepEqual(val, List{Atom{"foo"}}) {
+		t.Fatalf("expect (foo) but %v, %v", val, err)
+	}
+}
+
+func TestStringLiterals(t *testing.T) {
+	val, err := StringParser(MemoryParseState("\"first\nsecond\\q\\u4e2d\""))
+	if err != nil || val != "first\nsecond\\q中" {
+		t.Fatalf("expect multi-line string but %q, %v", val, err)
+	}
+	val, err = RuneParser(MemoryParseState(`'\n'`))
+	if err != nil || val != "\n" {
+		t.Fatalf("expect rune literal as string \"\\n\" but %#v, %v", val, err)
+	}
+	val, err = UnionAll(EscapeChar, EscapeChar)(MemoryParseState(`\t\'`))
+	if err != nil || !reflect.DeepEqual(val, []interface{}{'\t', '\''}) {
+		t.Fatalf("expect escapes \\t and \\' but %#v, %v", val, err)
+	}
+	if _, err := EscapeChar(MemoryParseState(`\q`)); err == nil {
+		t.Fatalf("expect unknown escape \\q fails")
+	}
+}
+
+func TestGrammarEBNF(t *testing.T) {
+	var out strings.Builder
+	if err := WriteEBNF(&out, Grammar()); err != nil {
+		t.Fatalf("expect write ebnf but %v", err)
+	}
+	for _, line := range []string{
+		"value  ::= string\n",
+		"string ::= /* string literal \"…\" */\n",
+		"quote  ::= \"'\" value /* … */\n",
+		"atom   ::= /* atom name */ /* … */\n",
+		"list   ::= (\"(\" atom /* … */ \")\" | \"(\" (value (/* space */+ value)*)? \")\") /* … */\n",
+	} {
+		if !strings.Contains(out.String(), line) {
+			t.Fatalf("expect ebnf contains %q but\n%s", line, out.String())
+		}
+	}
+}
+
+func TestValueProfile(t *testing.T) {
+	profiler := NewProfiler()
+	for _, code := range []string{"-2", "(+ 1 2)", "(foo)"} {
+		if _, err := Parse(ValueParser, code, WithObserver(profiler)); err != nil {
+			t.Fatalf("expect parse %s but %v", code, err)
+		}
+	}
+	stats := map[string]RuleStats{}
+	for _, s := range profiler.Stats() {
+		stats[s.Rule] = s
+	}
+	// (+ 1 2) 先按只有一个 atom 的 list 尝试，读到 + 之后的空白才失败，回退两个字符；
+	// number 中的 Try(Float) 读完 -2 、1 和 2 之后才发现不是浮点数，回退四个字符。
+	// 两个规则最终都成功了，回溯仍然记在它们上面。
+	if s := stats["list"]; s.Successes != 2 || s.Backtrack != 2 {
+		t.Fatalf("expect list backtrack 2 runes but %+v", s)
+	}
+	if s := stats["number"]; s.Successes != 3 || s.Backtrack != 4 {
+		t.Fatalf("expect number backtrack 4 runes but %+v", s)
+	}
+	if s := stats["value"]; s.Backtrack != 0 {
+		t.Fatalf("expect backtracking in nested rules not counted in value but %+v", s)
+	}
+}
@@ -5,14 +5,16 @@ import (
 	"strconv"
 )
 
+var numberParser = Either(
+	BindE(Try(Float), func(f interface{}) (Parser, error) {
+		value, err := strconv.ParseFloat(f.(string), 64)
+		return Return(value), err
+	}),
+	BindE(Int, func(i interface{}) (Parser, error) {
+		value, err := strconv.Atoi(i.(string))
+		return Return(value), err
+	}))
+
 func NumberParser(st ParseState) (interface{}, error) {
-	f, err := Try(Float)(st)
-	if err == nil {
-		return strconv.ParseFloat(f.(string), 64)
-	}
-	i, err := Int(st)
-	if err == nil {
-		return strconv.Atoi(i.(string))
-	}
-	return nil, err
+	return numberParser(st)
 }
@@ -4,38 +4,36 @@ import (
 	. "github.com/Dwarfartisan/goparsec"
 )
 
+// stringStyle 是 Go 的解释型字符串，单引号只用于 rune 。与 gisp 原来的写法一致，字符串
+// 中可以直接换行，不认识的转义按原样保留。
+var stringStyle = func() StringStyle {
+	style := GoStringStyle
+	style.RawQuotes = ""
+	style.Newlines = true
+	style.Lenient = true
+	return style
+}()
+
+// RuneParser 解析 Go 风格的 rune 字面量，结果是只有一个字符的 string
+var RuneParser = Bind(GoRune, func(x interface{}) Parser {
+	return Return(string(x.(rune)))
+})
+
+var StringParser = StringLiteral(stringStyle)
+
+// EscapeChar 解析 \ 开头的单字符转义，返回 rune 。转义的含义与 StringParser 和
+// RuneParser 使用的转义表一致。
+//
+// Deprecated: StringParser 和 RuneParser 已经自己处理转义，不再需要 EscapeChar 。
 var EscapeChar = Bind_(Rune('\\'), func(st ParseState) (interface{}, error) {
-	r, err := OneOf("nrt\"\\")(st)
-	if err == nil {
-		ru := r.(rune)
-		switch ru {
-		case 'r':
-			return '\r', nil
-		case 'n':
-			return '\n', nil
-		// FIXME:引号的解析偷懒了，单双引号的应该分开。
-		case '\'':
-			return '\'', nil
-		case '"':
-			return '"', nil
-		case '\\':
-			return '\\', nil
-		case 't':
-			return '\t', nil
-		default:
-			return nil, st.Trap("Unknown escape sequence \\%c", r)
-		}
-	} else {
+	r, err := AnyRune(st)
+	if err != nil {
 		return nil, err
 	}
+	for _, escapes := range []map[rune]string{stringStyle.Escapes, GoRuneStyle.Escapes} {
+		if s, ok := escapes[r.(rune)]; ok && s != "" {
+			return []rune(s)[0], nil
+		}
+	}
+	return nil, st.Trap("Unknown escape sequence \\%c", r)
 })
-
-var RuneParser = Bind(
-	Between(Rune('\''), Rune('\''),
-		Either(Try(EscapeChar), NoneOf("'"))),
-	ReturnString)
-
-var StringParser = Bind(
-	Between(Rune('"'), Rune('"'),
-		Many(Either(Try(EscapeChar), NoneOf("\"")))),
-	ReturnString)
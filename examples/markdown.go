@@ -14,21 +14,17 @@ var backslash = Bind_(String("\\\\"), Return("\\"))
 
 // return a text skip newline and exclude the runes
 func TextWithout(runes string) Parser {
-	var others = Bind(Many1(NoneOf(runes+NewLineRunes)), ReturnString)
+	var excludes = NewRuneSet(runes + NewLineRunes)
+	var others = TakeWhile1(func(r rune) bool { return !excludes.Contains(r) })
 	var content = Many1(Choice(Try(newline), Try(tab), Try(backslash), Try(others)))
 
-	return func(st ParseState) (interface{}, error) {
-		data, err := content(st)
-		if err == nil {
-			var text = ""
-			for _, item := range data.([]interface{}) {
-				text += item.(string)
-			}
-			return text, nil
-		} else {
-			return nil, err
+	return Bind(content, func(data interface{}) Parser {
+		var text = ""
+		for _, item := range data.([]interface{}) {
+			text += item.(string)
 		}
-	}
+		return Return(text)
+	})
 }
 
 var Brackets = Between(Rune('['), Rune(']'), TextWithout("]"))
@@ -36,57 +32,46 @@ var Parentheses = Between(Rune('('), Rune(')'), TextWithout(")"))
 
 var Entry = Between(String("[entry://"), Rune(']'), TextWithout("]"))
 
-func HTTP(st ParseState) (interface{}, error) {
-	parser := Between(String("[http://"), Rune(']'), TextWithout("]"))
-	data, err := parser(st)
-	if err == nil {
-		return map[string]interface{}{
-			"lnk": "http://" + string(data.([]rune)),
-		}, nil
-	} else {
-		return nil, err
-	}
-}
-
-var Link = Bind(Brackets,
-	func(cap interface{}) Parser {
-		return func(st ParseState) (interface{}, error) {
-			lnk, err := Parentheses(st)
-			if err == nil {
-				return map[string]interface{}{"cap": cap, "lnk": lnk}, nil
-			} else {
-				return nil, err
-			}
-		}
+var HTTP = Bind(Between(String("[http://"), Rune(']'), TextWithout("]")),
+	func(data interface{}) Parser {
+		return Return(map[string]interface{}{
+			"lnk": "http://" + data.(string),
+		})
 	},
 )
-var Code = Choice(Try(Entry), Try(Link), Try(HTTP))
 
-func MissMatch(st ParseState) (interface{}, error) {
-	p := Bind(Rune('['), func(r interface{}) Parser {
-		return func(st ParseState) (interface{}, error) {
-			data, err := plain(st)
-			buf := data.([]interface{})
-			buffer := make([]rune, 0, len(buf))
-			for _, item := range buf {
-				buffer = append(buffer, item.(rune))
-			}
+var Link = Bind(UnionAll(Brackets, Parentheses),
+	func(data interface{}) Parser {
+		pair := data.([]interface{})
+		return Return(map[string]interface{}{"cap": pair[0], "lnk": pair[1]})
+	},
+)
+var Code = Rule("code", Choice(Try(Rule("entry", Entry)), Try(Rule("link", Link)), Try(Rule("http", HTTP))))
 
-			if err == nil {
-				return string(r.(rune)) + string(buffer), nil
-			} else {
-				return nil, err
-			}
-		}
-	})
-	return p(st)
-}
+var MissMatch = Bind(UnionAll(Rune('['), plain), func(data interface{}) Parser {
+	pair := data.([]interface{})
+	return Return(string(pair[0].(rune)) + pair[1].(string))
+})
 
 var plain = TextWithout("[")
-var content = Choice(Try(plain), Try(Code), MissMatch)
-var Paragraph = ManyTil(content, Eof)
+var content = Choice(Try(Rule("plain", plain)), Try(Code), Rule("missMatch", MissMatch))
+var Paragraph = Rule("paragraph", ManyTil(content, Eof))
 
+// 使用 -trace 参数运行时，把各个规则的执行过程输出到 stderr 。使用 -ebnf 或 -railroad
+// 参数运行时，把 grammar 写成 W3C EBNF 或者带有铁路图的 HTML 页面，输出到 stdout 。
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "-trace":
+			SetTracer(NewTracer(os.Stderr))
+		case "-ebnf":
+			WriteEBNF(os.Stdout, Paragraph)
+			return
+		case "-railroad":
+			WriteRailroadHTML(os.Stdout, "markdown", Paragraph)
+			return
+		}
+	}
 	data, err := ioutil.ReadAll(os.Stdin)
 	if err != nil {
 		fmt.Println(err)
@@ -0,0 +1,91 @@
+package goparsec
+
+import "unicode"
+
+// Fold 指定 StringFoldWith 比较字符时忽略哪些差别，可以用 | 组合
+type Fold int
+
+const (
+	// FoldCase 按 unicode 的 simple case folding 忽略大小写，例如 K 、k 和 K（开尔文符号）
+	FoldCase Fold = 1 << iota
+	// FoldWidth 忽略全角和半角的差别，例如 （ 和 ( ， Ａ 和 A ，全角空格和空格
+	FoldWidth
+)
+
+// wideSymbols 是 U+FFE0 之后的全角符号对应的半角字符
+var wideSymbols = map[rune]rune{
+	'￠': '¢', '￡': '£', '￢': '¬', '￣': '¯',
+	'￤': '¦', '￥': '¥', '￦': '₩',
+}
+
+// narrow 把全角字符转为对应的半角字符，其它字符原样返回
+func narrow(r rune) rune {
+	switch {
+	case r >= '！' && r <= '～':
+		return r - 0xFEE0
+	case r == '　':
+		return ' '
+	}
+	if n, ok := wideSymbols[r]; ok {
+		return n
+	}
+	return r
+}
+
+// folder 构造判断一个字符是否与 r 在 mode 下等价的函数
+func folder(r rune, mode Fold) func(rune) bool {
+	if mode&FoldWidth != 0 {
+		r = narrow(r)
+	}
+	runes := []rune{r}
+	if mode&FoldCase != 0 {
+		for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+			runes = append(runes, f)
+		}
+	}
+	width := mode&FoldWidth != 0
+	return func(ru rune) bool {
+		if width {
+			ru = narrow(ru)
+		}
+		for _, item := range runes {
+			if item == ru {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// StringFold 与 String 相同，但是按 unicode simple case folding 忽略大小写，适合 SQL
+// 关键字或者 HTTP 头这样的场景。成功时返回 s 本身。
+func StringFold(s string) Parser {
+	return StringFoldWith(s, FoldCase)
+}
+
+// StringFoldWith 与 String 相同，但是按照 mode 忽略字符之间的差别。成功时返回 s 本身。
+func StringFoldWith(s string, mode Fold) Parser {
+	preds := []func(rune) bool{}
+	for _, r := range s {
+		preds = append(preds, folder(r, mode))
+	}
+	n := &Node{Kind: "stringFold", Literals: []string{s}, empty: s == ""}
+	if len(preds) > 0 {
+		n.first = preds[0]
+	}
+	return build(n, func(st ParseState) (interface{}, error) {
+		cp := Save(st)
+		for _, pred := range preds {
+			_, ok, err := st.Next(pred)
+			if err != nil {
+				Restore(st, cp)
+				return nil, err
+			}
+			if !ok {
+				Restore(st, cp)
+				return nil, st.Trap("Expected '%s'", s)
+			}
+		}
+		return s, nil
+	})
+}
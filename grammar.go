@@ -0,0 +1,488 @@
+package goparsec
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Parser 是函数类型，没法直接在上面挂载结构信息。这里的做法是：库内构造的 parser 都是
+// described 的方法值，Describe 根据函数的代码地址认出它们，再以 probeState 调用，得到
+// 构造时记录下来的 Node 。库内以函数定义的 parser ，例如 Eof ，登记在 leaves 中。
+// 其它 parser 都是用户写的，分析 grammar 时不会被执行，总是被当作不透明的叶子节点，
+// 即使它内部调用了库内的 parser 。用户可以用 Expect 给它们加上描述，用 Lazy 引用递归的
+// grammar 。
+
+// Node 描述一个库内构造的 parser ，由 Describe 得到。对 Children 继续调用 Describe
+// 可以遍历整个 grammar 。同一个组合子总是返回同一个 Node ，用 Lazy 定义的递归 grammar
+// 在遍历时会回到访问过的 Node 。
+type Node struct {
+	// Kind 是组合子的种类，例如 "choice" 、"many" 、"string" 和 "rule"
+	Kind     string
+	Children []Parser
+	// Label 是命名规则的名字
+	Label string
+	// Literals 是叶子节点匹配的字面量，例如 String 的字符串、OneOf 的每一个字符和
+	// Keywords 的每一个关键字。Negated 表示匹配字面量以外的字符，例如 NoneOf 。
+	Literals []string
+	Negated  bool
+	// Expected 描述叶子节点期望的输入，例如 RuneChecker 的 expected 参数
+	Expected string
+	// first 是叶子节点可以接受的第一个字符，empty 表示叶子节点可以不消耗输入而成功
+	first func(rune) bool
+	empty bool
+}
+
+// probeState 只用于分析 grammar 结构，不代表真实的输入，只会传给 described
+type probeState struct{}
+
+func (probeState) Next(pred func(rune) bool) (rune, bool, error) {
+	return '\000', false, io.EOF
+}
+func (probeState) Line() int   { return 0 }
+func (probeState) Column() int { return 0 }
+func (probeState) Pos() int    { return 0 }
+func (probeState) SeekTo(int)  {}
+func (probeState) Trap(message string, args ...interface{}) error {
+	return fmt.Errorf(message, args...)
+}
+
+// described 是库内构造的 parser ，node 是它的结构。node 为 nil 时 run 自己处理
+// probeState ，用于构造时还得不到子 parser 的 Lazy 。
+type described struct {
+	node *Node
+	// nested 为 true 时 run 计入 RunContext 的嵌套深度
+	nested bool
+	run    Parser
+}
+
+func (this *described) parse(st ParseState) (interface{}, error) {
+	if this.node != nil {
+		if _, ok := st.(probeState); ok {
+			return this.node, nil
+		}
+	}
+	if this.nested {
+		if lim := limiterOf(st); lim != nil {
+			if err := lim.enter(st); err != nil {
+				return nil, err
+			}
+			defer lim.leave()
+		}
+	}
+	return this.run(st)
+}
+
+// build 把 run 包装为库内的 parser ，Describe 对它返回 n
+func build(n *Node, run Parser) Parser {
+	return (&described{node: n, run: run}).parse
+}
+
+// nest 与 build 相同，用于执行子 parser 的组合子，run 执行期间嵌套深度加一
+func nest(n *Node, run Parser) Parser {
+	return (&described{node: n, nested: true, run: run}).parse
+}
+
+// codeOf 返回 p 的代码地址，同一个函数字面量或者方法值构造的 parser 地址相同
+func codeOf(p Parser) uintptr {
+	return reflect.ValueOf(p).Pointer()
+}
+
+// describedCode 是所有 described 方法值共同的代码地址，用户的代码无法构造出这样的函数
+var describedCode = codeOf((*described)(nil).parse)
+
+// leaves 是库内以函数定义的 parser 和它们的结构
+var leaves = map[uintptr]*Node{
+	codeOf(Eof):         eofNode,
+	codeOf(AnyRune):     anyRuneNode,
+	codeOf(IndentGuard): indentGuardNode,
+	codeOf(Indented):    indentedNode,
+	codeOf(GetState):    getStateNode,
+}
+
+// Describe 返回库内构造的 parser 的结构，对用户写的 parser 返回 nil 。Describe 不会执行
+// 用户写的 parser ，只会调用 Lazy 的 get 。
+func Describe(p Parser) *Node {
+	if p == nil {
+		return nil
+	}
+	code := codeOf(p)
+	if n, ok := leaves[code]; ok {
+		return n
+	}
+	if code != describedCode {
+		return nil
+	}
+	value, _ := p(probeState{})
+	n, _ := value.(*Node)
+	return n
+}
+
+// runeLiterals 把 runes 中的每一个字符作为一个字面量
+func runeLiterals(runes string) []string {
+	ret := []string{}
+	for _, r := range runes {
+		ret = append(ret, string(r))
+	}
+	return ret
+}
+
+// Lazy 在执行时才调用 get 得到 parser ，用于定义递归的 grammar ：
+//
+//	var expr Parser
+//	term := Either(number, Between(Rune('('), Rune(')'), Lazy(func() Parser { return expr })))
+//	expr = SepBy1(term, Rune('+'))
+//
+// 与直接写一个调用 expr 的函数不同，Lazy 对 Describe 是透明的，所以递归的 grammar 也
+// 可以分析，Validate 可以找出其中的左递归。
+func Lazy(get func() Parser) Parser {
+	var once sync.Once
+	var n *Node
+	return build(nil, func(st ParseState) (interface{}, error) {
+		p := get()
+		if _, ok := st.(probeState); ok {
+			if p == nil {
+				return nil, nil
+			}
+			once.Do(func() {
+				n = &Node{Kind: "lazy", Children: []Parser{p}}
+			})
+			return n, nil
+		}
+		return p(st)
+	})
+}
+
+// Expect 给 p 加上期望输入的描述，p 的执行不受影响。导出 grammar 时 p 写成这个描述，
+// 用于 TakeWhile1 这样条件无法导出的 parser ，或者给用户写的 parser 加上描述，例如
+// Expect("identifier", TakeWhile1(isIdent))。
+func Expect(expected string, p Parser) Parser {
+	return build(&Node{Kind: "expect", Children: []Parser{p}, Expected: expected}, p)
+}
+
+// Lazy 的 get 每次可能返回新构造的 parser ，所以分析递归的 grammar 时需要限定深度
+const maxProbeDepth = 64
+
+// leading 描述 parser 在开头能够接受的输入
+type leading struct {
+	// first 判断一个 rune 能否作为 parser 消耗的第一个字符，nil 表示不接受任何字符
+	first func(rune) bool
+	// empty 表示 parser 可以不消耗输入而成功
+	empty bool
+}
+
+func (l leading) accept(r rune) bool {
+	return l.empty || (l.first != nil && l.first(r))
+}
+
+func unionFirst(x, y func(rune) bool) func(rune) bool {
+	if x == nil {
+		return y
+	}
+	if y == nil {
+		return x
+	}
+	return func(r rune) bool {
+		return x(r) || y(r)
+	}
+}
+
+// onPath 判断 n 是否已经在分析的路径上，递归的 grammar 回到路径上的节点时无法判断
+func onPath(path []*Node, n *Node) bool {
+	for _, m := range path {
+		if m == n {
+			return true
+		}
+	}
+	return false
+}
+
+// analyse 计算 p 的 leading 信息，known 为 false 表示无法判断。
+// 对于 leading 不接受的字符，p 一定会不消耗输入地失败。
+func analyse(p Parser, path []*Node) (l leading, known bool) {
+	if len(path) > maxProbeDepth {
+		return leading{}, false
+	}
+	n := Describe(p)
+	if n == nil || onPath(path, n) {
+		return leading{}, false
+	}
+	path = append(path, n)
+	switch n.Kind {
+	case "try", "many1", "sepBy1", "span", "withPos", "block", "lineFold", "guard", "where", "rule", "lazy",
+		"expect":
+		return analyse(n.Children[0], path)
+	case "many", "skip", "option":
+		l, known = analyse(n.Children[0], path)
+		l.empty = true
+		return l, known
+	case "bind":
+		l, known = analyse(n.Children[0], path)
+		if l.empty {
+			// 后继的 parser 要到运行时才能得到
+			return leading{}, false
+		}
+		return l, known
+	case "either", "choice":
+		for _, child := range n.Children {
+			cl, k := analyse(child, path)
+			if !k {
+				return leading{}, false
+			}
+			l.first = unionFirst(l.first, cl.first)
+			l.empty = l.empty || cl.empty
+		}
+		return l, true
+	case "bind_", "between", "union", "unionAll":
+		l.empty = true
+		for _, child := range n.Children {
+			cl, k := analyse(child, path)
+			if !k {
+				return leading{}, false
+			}
+			l.first = unionFirst(l.first, cl.first)
+			if !cl.empty {
+				l.empty = false
+				break
+			}
+		}
+		return l, true
+	case "manyTil":
+		pl, pk := analyse(n.Children[0], path)
+		el, ek := analyse(n.Children[1], path)
+		if !pk || !ek {
+			return leading{}, false
+		}
+		return leading{unionFirst(el.first, pl.first), el.empty}, true
+	default:
+		return leading{n.first, n.empty}, true
+	}
+}
+
+// nullable 判断 p 是否可能不消耗输入而成功，known 为 false 表示无法判断
+func nullable(p Parser, path []*Node) (empty bool, known bool) {
+	if len(path) > maxProbeDepth {
+		return false, false
+	}
+	n := Describe(p)
+	if n == nil || onPath(path, n) {
+		return false, false
+	}
+	path = append(path, n)
+	switch n.Kind {
+	case "try", "many1", "sepBy1", "span", "withPos", "block", "lineFold", "guard", "where", "rule", "lazy",
+		"expect":
+		return nullable(n.Children[0], path)
+	case "bind":
+		empty, known = nullable(n.Children[0], path)
+		if empty {
+			// 后继的 parser 要到运行时才能得到
+			return false, false
+		}
+		return false, known
+	case "either", "choice":
+		known = true
+		for _, child := range n.Children {
+			e, k := nullable(child, path)
+			if e {
+				return true, true
+			}
+			known = known && k
+		}
+		return false, known
+	case "bind_", "between", "union", "unionAll":
+		known = true
+		for _, child := range n.Children {
+			e, k := nullable(child, path)
+			if k && !e {
+				return false, true
+			}
+			known = known && k
+		}
+		return known, known
+	case "manyTil":
+		return nullable(n.Children[1], path)
+	default:
+		return n.empty, true
+	}
+}
+
+// First 计算 p 开头能够接受的输入：accept 判断一个字符能否作为 p 消耗的第一个字符，
+// empty 表示 p 可以不消耗输入而成功。grammar 中有无法分析的不透明 parser 时 known 为
+// false 。
+func First(p Parser) (accept func(rune) bool, empty bool, known bool) {
+	l, known := analyse(p, nil)
+	if !known {
+		return nil, false, false
+	}
+	if l.first == nil {
+		return never, l.empty, true
+	}
+	return l.first, l.empty, true
+}
+
+// Nullable 判断 p 是否可能不消耗输入而成功，grammar 中有无法分析的不透明 parser 时
+// known 为 false
+func Nullable(p Parser) (empty bool, known bool) {
+	return nullable(p, nil)
+}
+
+// leadingChildren 返回 n 在不消耗输入的情况下可能执行的子 parser
+func leadingChildren(n *Node) []Parser {
+	switch n.Kind {
+	case "try", "many1", "sepBy1", "span", "withPos", "block", "lineFold", "guard", "where", "rule", "lazy",
+		"expect", "many", "skip", "option", "bind":
+		return n.Children[:1]
+	case "either", "choice", "manyTil":
+		return n.Children
+	case "bind_", "between", "union", "unionAll":
+		for idx, child := range n.Children {
+			if empty, known := nullable(child, nil); known && !empty {
+				return n.Children[:idx+1]
+			}
+		}
+		return n.Children
+	default:
+		return nil
+	}
+}
+
+// leftRecursion 找出 grammar 中不消耗输入就能回到自身的环，这样的规则在运行时会无限递归
+func leftRecursion(p Parser) []string {
+	var problems []string
+	done := map[*Node]bool{}
+	var stack []*Node
+	var walk func(p Parser)
+	walk = func(p Parser) {
+		if len(stack) > maxProbeDepth {
+			return
+		}
+		n := Describe(p)
+		if n == nil || done[n] {
+			return
+		}
+		for idx, visiting := range stack {
+			if visiting == n {
+				path := []string{}
+				for _, m := range append(stack[idx:], n) {
+					if m.Label != "" {
+						path = append(path, m.Label)
+					} else {
+						path = append(path, m.Kind)
+					}
+				}
+				problems = append(problems, fmt.Sprintf(
+					"%s: left recursion, the parser may call itself without consuming input",
+					strings.Join(path, " -> ")))
+				return
+			}
+		}
+		stack = append(stack, n)
+		for _, child := range leadingChildren(n) {
+			walk(child)
+		}
+		stack = stack[:len(stack)-1]
+		done[n] = true
+	}
+	walk(p)
+	return problems
+}
+
+// repeats 中的组合子会反复执行第一个子 parser
+var repeats = map[string]bool{
+	"many":    true,
+	"many1":   true,
+	"skip":    true,
+	"sepBy1":  true,
+	"manyTil": true,
+	"block":   true,
+}
+
+// Validate 静态检查 grammar ，找出对可能不消耗输入即成功的 parser 做重复的规则，例如
+// Many(Maybe(x)) 或 Many(Spaces)，这类规则在运行时会因为没有进展而报错；以及通过 Lazy
+// 形成的左递归，这类规则在运行时会无限递归。不透明的 parser 无法分析，会被跳过。
+func Validate(p Parser) error {
+	var problems []string
+	visited := map[*Node]bool{}
+	var walk func(p Parser, path []string, depth int)
+	walk = func(p Parser, path []string, depth int) {
+		if depth > maxProbeDepth {
+			return
+		}
+		n := Describe(p)
+		if n == nil || visited[n] {
+			return
+		}
+		visited[n] = true
+		if n.Label != "" {
+			path = append(path, n.Label)
+		} else {
+			path = append(path, n.Kind)
+		}
+		if repeats[n.Kind] {
+			if empty, _ := nullable(n.Children[0], nil); empty {
+				problems = append(problems, fmt.Sprintf(
+					"%s: repeated parser may succeed without consuming input",
+					strings.Join(path, "/")))
+			}
+		}
+		for _, child := range n.Children {
+			walk(child, path, depth+1)
+		}
+	}
+	walk(p, nil, 0)
+	problems = append(problems, leftRecursion(p)...)
+	if len(problems) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(problems, "\n"))
+}
+
+// dispatch 是 Choice 按照下一个字符选择分支的查找表
+type dispatch struct {
+	alternatives []leading
+	known        []bool
+	// ascii 保存每个 ascii 字符可能匹配的分支下标
+	ascii [128][]int
+	// eof 保存在输入结束时仍然需要尝试的分支下标
+	eof []int
+}
+
+// newDispatch 分析 Choice 的各个分支，如果没有任何分支能被排除，返回 nil
+func newDispatch(parsers []Parser) *dispatch {
+	d := &dispatch{
+		alternatives: make([]leading, len(parsers)),
+		known:        make([]bool, len(parsers)),
+	}
+	useful := false
+	for idx, p := range parsers {
+		d.alternatives[idx], d.known[idx] = analyse(p, nil)
+		if d.known[idx] && !d.alternatives[idx].empty {
+			useful = true
+		}
+	}
+	if !useful {
+		return nil
+	}
+	for r := range d.ascii {
+		for idx := range parsers {
+			if d.match(idx, rune(r)) {
+				d.ascii[r] = append(d.ascii[r], idx)
+			}
+		}
+	}
+	for idx := range parsers {
+		if !d.known[idx] || d.alternatives[idx].empty {
+			d.eof = append(d.eof, idx)
+		}
+	}
+	return d
+}
+
+// match 判断第 idx 个分支是否可能从 r 开始匹配
+func (d *dispatch) match(idx int, r rune) bool {
+	return !d.known[idx] || d.alternatives[idx].accept(r)
+}
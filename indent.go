@@ -0,0 +1,127 @@
+package goparsec
+
+import "io"
+
+// indentation 返回 st 的缩进接口，st 没有实现 Indentation 时返回错误
+func indentation(st ParseState) (Indentation, error) {
+	for state := st; state != nil; state = unwrap(state) {
+		if indent, ok := state.(Indentation); ok {
+			return indent, nil
+		}
+	}
+	return nil, st.Trap("state %T does not support indentation", st)
+}
+
+// atEOF 判断 st 是否已经到达输入的结尾
+func atEOF(st ParseState) bool {
+	_, _, err := st.Next(never)
+	return err == io.EOF
+}
+
+var indentGuardNode = &Node{Kind: "indentGuard", empty: true}
+
+// IndentGuard 检查当前列是否等于参考缩进，不消耗输入，成功时返回当前列（int）。
+func IndentGuard(st ParseState) (interface{}, error) {
+	indent, err := indentation(st)
+	if err != nil {
+		return nil, err
+	}
+	if st.Column() != indent.Indent() {
+		return nil, st.Trap("incorrect indentation (got %d, expected %d)", st.Column(), indent.Indent())
+	}
+	return st.Column(), nil
+}
+
+var indentedNode = &Node{Kind: "indented", empty: true}
+
+// Indented 检查当前列是否比参考缩进更深，不消耗输入，成功时返回当前列（int）。
+func Indented(st ParseState) (interface{}, error) {
+	indent, err := indentation(st)
+	if err != nil {
+		return nil, err
+	}
+	if st.Column() <= indent.Indent() {
+		return nil, st.Trap("incorrect indentation (got %d, expected greater than %d)",
+			st.Column(), indent.Indent())
+	}
+	return st.Column(), nil
+}
+
+// withIndent 以 column 为参考缩进执行 p ，结束后恢复原来的参考缩进
+func withIndent(st ParseState, column int, p Parser) (interface{}, error) {
+	indent, err := indentation(st)
+	if err != nil {
+		return nil, err
+	}
+	saved := indent.Indent()
+	indent.SetIndent(column)
+	defer indent.SetIndent(saved)
+	return p(st)
+}
+
+// WithPos 把当前列作为参考缩进执行 p ，p 结束后恢复原来的参考缩进。
+func WithPos(p Parser) Parser {
+	n := &Node{Kind: "withPos", Children: []Parser{p}}
+	return nest(n, func(st ParseState) (interface{}, error) {
+		return withIndent(st, st.Column(), p)
+	})
+}
+
+// Block 匹配一个或多个起始列相同的 p ，以第一个 p 的列为参考缩进，返回 []interface{} 。
+// p 需要自己消耗之后的空白和换行。下一项的列小于参考缩进或者到达结尾时 Block 结束，
+// 大于参考缩进时返回 "incorrect indentation" 错误。
+func Block(p Parser) Parser {
+	n := &Node{Kind: "block", Children: []Parser{p}}
+	return nest(n, func(st ParseState) (interface{}, error) {
+		return withIndent(st, st.Column(), func(st ParseState) (interface{}, error) {
+			indent, err := indentation(st)
+			if err != nil {
+				return nil, err
+			}
+			values := []interface{}{}
+			for {
+				pos := st.Pos()
+				val, err := p(st)
+				if err != nil {
+					return nil, err
+				}
+				if st.Pos() == pos {
+					return nil, noProgress(st, "Block")
+				}
+				values = append(values, val)
+				if atEOF(st) || st.Column() < indent.Indent() {
+					return values, nil
+				}
+				if _, err := IndentGuard(st); err != nil {
+					return nil, err
+				}
+			}
+		})
+	})
+}
+
+// LineFold 匹配可以折行书写的 p 。它以当前列为参考缩进，调用 p 时传入的 space 在
+// 跳过空白后检查后续内容是否比参考缩进更深，不是的话不消耗输入并失败，表示折行结束。
+// 同一行里的后续内容总是比开始的列更深，所以 p 可以在所有 token 之间使用 space 。
+func LineFold(space Parser, p func(space Parser) Parser) Parser {
+	folded := func(st ParseState) (interface{}, error) {
+		cp := Save(st)
+		if _, err := space(st); err != nil {
+			return nil, err
+		}
+		if atEOF(st) {
+			Restore(st, cp)
+			return nil, st.Trap("line fold ends at end of file")
+		}
+		if _, err := Indented(st); err != nil {
+			Restore(st, cp)
+			return nil, err
+		}
+		return nil, nil
+	}
+	fold := p(folded)
+	n := &Node{Kind: "lineFold", Children: []Parser{fold}}
+	return nest(n, func(st ParseState) (interface{}, error) {
+		return withIndent(st, st.Column(), fold)
+	})
+}
@@ -0,0 +1,89 @@
+package goparsec
+
+import "io"
+
+// trie 是 Keywords 使用的前缀树，每个节点的 pred 在构造时生成，匹配时不再分配闭包
+type trie struct {
+	children map[rune]*trie
+	pred     func(rune) bool
+	word     string
+	terminal bool
+}
+
+func newTrie() *trie {
+	t := &trie{children: map[rune]*trie{}}
+	t.pred = func(r rune) bool {
+		_, ok := t.children[r]
+		return ok
+	}
+	return t
+}
+
+func (this *trie) insert(word string) {
+	current := this
+	for _, r := range word {
+		child, ok := current.children[r]
+		if !ok {
+			child = newTrie()
+			current.children[r] = child
+		}
+		current = child
+	}
+	current.word = word
+	current.terminal = true
+}
+
+// Keywords 用前缀树匹配 words 中的一个关键字，总是选择最长的匹配，所以不需要关心关键字
+// 的顺序（例如 in 和 int）。成功时返回匹配到的关键字，失败时不消耗输入。空串会被忽略。
+func Keywords(words ...string) Parser {
+	return KeywordsBounded(nil, words...)
+}
+
+// KeywordsBounded 与 Keywords 相同，但是要求关键字之后不能紧跟满足 wordRune 的字符，
+// 例如在 "int8" 中不会匹配关键字 "int" 。如果最长的关键字之后不是边界，会继续尝试较短
+// 的关键字。wordRune 为 nil 时不检查边界。
+func KeywordsBounded(wordRune func(rune) bool, words ...string) Parser {
+	root := newTrie()
+	literals := []string{}
+	for _, word := range words {
+		if word != "" {
+			root.insert(word)
+			literals = append(literals, word)
+		}
+	}
+	n := &Node{Kind: "keywords", Literals: literals, first: root.pred}
+	return build(n, func(st ParseState) (interface{}, error) {
+		start := Save(st)
+		// 记录路径上每个关键字结束的位置，从最长的开始检查边界
+		ends := []Checkpoint{}
+		matched := []*trie{}
+		current := root
+		for {
+			r, ok, err := st.Next(current.pred)
+			if err != nil && err != io.EOF {
+				Restore(st, start)
+				return nil, err
+			}
+			if !ok {
+				break
+			}
+			current = current.children[r]
+			if current.terminal {
+				ends = append(ends, Save(st))
+				matched = append(matched, current)
+			}
+		}
+		for idx := len(ends) - 1; idx >= 0; idx-- {
+			Restore(st, ends[idx])
+			if wordRune == nil {
+				return matched[idx].word, nil
+			}
+			r, _, err := st.Next(never)
+			if err == io.EOF || (err == nil && !wordRune(r)) {
+				return matched[idx].word, nil
+			}
+		}
+		Restore(st, start)
+		return nil, st.Trap("expected one of keywords %v", words)
+	})
+}
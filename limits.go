@@ -0,0 +1,212 @@
+package goparsec
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+)
+
+// Limits 是 RunContext 执行 parser 时的资源限制，为 0 的字段表示不限制
+type Limits struct {
+	// MaxSteps 是读取输入的最大次数，每次 Next 和批量扫描的每个字符都算作一步，
+	// 回溯之后重新读取的输入也会计入
+	MaxSteps int
+	// MaxDepth 是组合子的最大嵌套深度，例如嵌套的括号会使深度不断增加
+	MaxDepth int
+	// MaxInput 是输入的最大字符数
+	MaxInput int
+}
+
+// CanceledError 表示 context 在解析完成前被取消或者超时，Err 是 ctx.Err()
+type CanceledError struct {
+	Pos int
+	Err error
+}
+
+func (err CanceledError) Error() string {
+	return fmt.Sprintf("pos %d: parsing canceled: %v", err.Pos, err.Err)
+}
+
+// StepLimitError 表示读取输入的次数超过了 Limits.MaxSteps
+type StepLimitError struct {
+	Pos   int
+	Limit int
+}
+
+func (err StepLimitError) Error() string {
+	return fmt.Sprintf("pos %d: parsing exceeded the limit of %d steps", err.Pos, err.Limit)
+}
+
+// DepthLimitError 表示组合子的嵌套深度超过了 Limits.MaxDepth
+type DepthLimitError struct {
+	Pos   int
+	Limit int
+}
+
+func (err DepthLimitError) Error() string {
+	return fmt.Sprintf("pos %d: parsing exceeded the nesting depth limit of %d", err.Pos, err.Limit)
+}
+
+// InputLimitError 表示输入超过了 Limits.MaxInput 个字符
+type InputLimitError struct {
+	Limit int
+}
+
+func (err InputLimitError) Error() string {
+	return fmt.Sprintf("input exceeds the limit of %d runes", err.Limit)
+}
+
+// cancelInterval 是检查 context 的间隔步数
+const cancelInterval = 256
+
+// limiter 记录一次 RunContext 的资源使用，第一个错误会一直保留，之后的读取都返回它，
+// 使解析尽快结束
+type limiter struct {
+	ctx    context.Context
+	limits Limits
+	steps  int
+	depth  int
+	// stream 表示输入的长度无法预先知道，需要在读取时检查 MaxInput
+	stream bool
+	err    error
+}
+
+// step 记录读取一次输入，st 位于读取之前的位置
+func (this *limiter) step(st ParseState) error {
+	if this.err != nil {
+		return this.err
+	}
+	this.steps++
+	if this.limits.MaxSteps > 0 && this.steps > this.limits.MaxSteps {
+		this.err = StepLimitError{st.Pos(), this.limits.MaxSteps}
+	} else if this.stream && this.limits.MaxInput > 0 && st.Pos() >= this.limits.MaxInput {
+		// 流式的输入读取到超出限制的位置时才能发现
+		if _, _, err := st.Next(never); err == nil {
+			this.err = InputLimitError{this.limits.MaxInput}
+		}
+	} else if this.steps%cancelInterval == 0 {
+		this.cancel(st)
+	}
+	return this.err
+}
+
+func (this *limiter) cancel(st ParseState) error {
+	if this.err == nil {
+		select {
+		case <-this.ctx.Done():
+			this.err = CanceledError{st.Pos(), this.ctx.Err()}
+		default:
+		}
+	}
+	return this.err
+}
+
+func (this *limiter) enter(st ParseState) error {
+	if this.err != nil {
+		return this.err
+	}
+	this.depth++
+	if this.limits.MaxDepth > 0 && this.depth > this.limits.MaxDepth {
+		this.err = DepthLimitError{st.Pos(), this.limits.MaxDepth}
+	}
+	return this.err
+}
+
+// limited 由可以挂载 limiter 的 state 实现
+type limited interface {
+	limiter() *limiter
+	setLimiter(lim *limiter)
+}
+
+// running 是正在执行的 RunContext 的个数。为 0 时没有任何 state 挂载了 limiter ，
+// 组合子不需要检查 state ，也不需要记录嵌套深度。
+var running int32
+
+// limiterOf 返回 st 上挂载的 limiter ，没有时返回 nil 。组合子在执行子 parser 之前用
+// lim.enter 记录嵌套深度，返回 nil 时在结束时调用 lim.leave 。
+func limiterOf(st ParseState) *limiter {
+	if atomic.LoadInt32(&running) == 0 {
+		return nil
+	}
+	if l, ok := st.(limited); ok {
+		return l.limiter()
+	}
+	return nil
+}
+
+func (this *limiter) leave() {
+	this.depth--
+}
+
+// limitedState 为没有实现 limited 的 state 计数，它只保留 ParseState 、Checkpointer 和
+// Observable 的方法
+type limitedState struct {
+	ParseState
+	lim *limiter
+}
+
+func (this *limitedState) Next(pred func(rune) bool) (rune, bool, error) {
+	if err := this.lim.step(this.ParseState); err != nil {
+		return '\000', false, err
+	}
+	return this.ParseState.Next(pred)
+}
+
+func (this *limitedState) Checkpoint() Checkpoint {
+	return Save(this.ParseState)
+}
+
+func (this *limitedState) Restore(cp Checkpoint) {
+	Restore(this.ParseState, cp)
+}
+
+func (this *limitedState) Observer() Observer {
+	return observerOf(this.ParseState)
+}
+
+func (this *limitedState) SetObserver(observer Observer) {
+	if o, ok := this.ParseState.(Observable); ok {
+		o.SetObserver(observer)
+	}
+}
+
+func (this *limitedState) limiter() *limiter {
+	return this.lim
+}
+
+func (this *limitedState) setLimiter(lim *limiter) {
+	this.lim = lim
+}
+
+// RunContext 在 limits 的限制下用 p 解析 st ，ctx 被取消时停止解析，ctx 为 nil 时按
+// context.Background() 处理。超出限制时返回 CanceledError 、StepLimitError 、
+// DepthLimitError 或 InputLimitError ，而不是 p 在收尾时产生的其它错误。没有实现内部
+// 计数接口的 state 会被包装起来，这时除了 Observable 以外，Scanner 、Indentation 和
+// UserState 等可选接口不可用。
+func RunContext(ctx context.Context, p Parser, st ParseState, limits Limits) (interface{}, error) {
+	atomic.AddInt32(&running, 1)
+	defer atomic.AddInt32(&running, -1)
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	lim := &limiter{ctx: ctx, limits: limits}
+	if err := lim.cancel(st); err != nil {
+		return nil, err
+	}
+	if mem, ok := st.(*StateInMemory); ok && limits.MaxInput > 0 && len(mem.buffer) > limits.MaxInput {
+		return nil, InputLimitError{limits.MaxInput}
+	}
+	target, ok := st.(limited)
+	if !ok {
+		target = &limitedState{ParseState: st}
+		lim.stream = true
+	}
+	saved := target.limiter()
+	target.setLimiter(lim)
+	defer target.setLimiter(saved)
+	value, err := p(target.(ParseState))
+	if lim.err != nil {
+		return nil, lim.err
+	}
+	return value, err
+}
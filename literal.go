@@ -0,0 +1,322 @@
+package goparsec
+
+import (
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// StringStyle 描述一种字符串字面量的写法，StringLiteral 根据它生成 parser 。
+type StringStyle struct {
+	// Quotes 是处理转义的引号，例如 Go 的 " 或 Python 的 " 和 '
+	Quotes string
+	// RawQuotes 是不处理转义的引号，例如 Go 的 ` 和 shell 的 '
+	RawQuotes string
+	// RawPrefixes 是写在引号之前、表示不处理转义的前缀字符，例如 Python 的 r"..."
+	RawPrefixes string
+	// Escapes 是 \ 之后单个字符的转义结果，例如 'n' 对应 "\n" ，映射到空串表示忽略，
+	// 例如 shell 和 Python 中的 \ 加换行
+	Escapes map[rune]string
+	// Hex 支持 \xHH
+	Hex bool
+	// Unicode 支持 \uXXXX ，Unicode32 支持 \UXXXXXXXX
+	Unicode   bool
+	Unicode32 bool
+	// Surrogates 表示 \uXXXX 可以是 UTF-16 代理对，两个转义组合为一个字符（JSON）
+	Surrogates bool
+	// Octal 支持 \O 、\OO 和 \OOO 形式的八进制转义
+	Octal bool
+	// Bytes 表示 \x 和八进制转义是一个字节而不是一个 unicode 字符，此时八进制转义需要
+	// 正好三位（Go）
+	Bytes bool
+	// Lenient 表示不认识的转义按原样保留，例如 Python 中的 "\q" 就是 `\q`
+	Lenient bool
+	// Newlines 表示字符串中可以直接出现换行，raw 字符串总是可以包含换行
+	Newlines bool
+	// NoControl 表示字符串中不能直接出现 U+0020 以下的控制字符（JSON）
+	NoControl bool
+}
+
+var (
+	// GoStringStyle 是 Go 的解释型字符串和 ` 包围的 raw 字符串
+	GoStringStyle = StringStyle{
+		Quotes:    `"`,
+		RawQuotes: "`",
+		Escapes: map[rune]string{
+			'a': "\a", 'b': "\b", 'f': "\f", 'n': "\n", 'r': "\r", 't': "\t", 'v': "\v",
+			'\\': "\\", '"': "\"",
+		},
+		Hex:       true,
+		Unicode:   true,
+		Unicode32: true,
+		Octal:     true,
+		Bytes:     true,
+	}
+	// GoRuneStyle 是 Go 的 rune 字面量，与 RuneLiteral 一起使用
+	GoRuneStyle = StringStyle{
+		Quotes: "'",
+		Escapes: map[rune]string{
+			'a': "\a", 'b': "\b", 'f': "\f", 'n': "\n", 'r': "\r", 't': "\t", 'v': "\v",
+			'\\': "\\", '\'': "'",
+		},
+		Hex:       true,
+		Unicode:   true,
+		Unicode32: true,
+		Octal:     true,
+		Bytes:     true,
+	}
+	// JSONStringStyle 是 JSON 的字符串
+	JSONStringStyle = StringStyle{
+		Quotes: `"`,
+		Escapes: map[rune]string{
+			'b': "\b", 'f': "\f", 'n': "\n", 'r': "\r", 't': "\t",
+			'\\': "\\", '"': "\"", '/': "/",
+		},
+		Unicode:    true,
+		Surrogates: true,
+		NoControl:  true,
+	}
+	// PythonStringStyle 是 Python 3 单行的字符串，支持 ' 和 " 以及 r 前缀的 raw 字符串
+	PythonStringStyle = StringStyle{
+		Quotes:      `"'`,
+		RawPrefixes: "rR",
+		Escapes: map[rune]string{
+			'a': "\a", 'b': "\b", 'f': "\f", 'n': "\n", 'r': "\r", 't': "\t", 'v': "\v",
+			'\\': "\\", '"': "\"", '\'': "'", '\n': "",
+		},
+		Hex:       true,
+		Unicode:   true,
+		Unicode32: true,
+		Octal:     true,
+		Lenient:   true,
+	}
+	// ShellStringStyle 是 POSIX shell 的引号，' 之间不处理转义，" 之间只转义 $ ` " \ 和换行
+	ShellStringStyle = StringStyle{
+		Quotes:    `"`,
+		RawQuotes: "'",
+		Escapes: map[rune]string{
+			'$': "$", '`': "`", '"': "\"", '\\': "\\", '\n': "",
+		},
+		Lenient:  true,
+		Newlines: true,
+	}
+)
+
+var (
+	GoString     = StringLiteral(GoStringStyle)
+	GoRune       = RuneLiteral(GoRuneStyle)
+	JSONString   = StringLiteral(JSONStringStyle)
+	PythonString = StringLiteral(PythonStringStyle)
+	ShellString  = StringLiteral(ShellStringStyle)
+)
+
+func isHexDigit(r rune) bool {
+	return strings.IndexRune("0123456789abcdefABCDEF", r) >= 0
+}
+
+func isOctalDigit(r rune) bool {
+	return r >= '0' && r <= '7'
+}
+
+// literalExpected 描述 style 的字面量写法，例如 string literal "…" or `…`
+func literalExpected(kind string, style StringStyle) string {
+	forms := []string{}
+	for _, q := range style.Quotes + style.RawQuotes {
+		forms = append(forms, string(q)+"…"+string(q))
+	}
+	if style.RawPrefixes != "" {
+		for _, q := range style.Quotes {
+			forms = append(forms, "["+style.RawPrefixes+"]"+string(q)+"…"+string(q))
+		}
+	}
+	return kind + " literal " + strings.Join(forms, " or ")
+}
+
+// StringLiteral 根据 style 生成字符串字面量的 parser ，返回去掉引号、处理过转义的
+// string 。不合法的转义报告在 \ 所在的位置，没有结束的字符串报告在开始的引号处。
+func StringLiteral(style StringStyle) Parser {
+	quotes := NewRuneSet(style.Quotes)
+	raws := NewRuneSet(style.RawQuotes)
+	prefixes := NewRuneSet(style.RawPrefixes)
+	starts := NewRuneSet(style.Quotes + style.RawQuotes + style.RawPrefixes)
+	n := &Node{Kind: "stringLiteral", Expected: literalExpected("string", style), first: starts.Contains}
+	return build(n, func(st ParseState) (interface{}, error) {
+		start := Save(st)
+		quote, ok, err := st.Next(starts.Contains)
+		if err != nil {
+			if err == io.EOF {
+				return nil, st.Trap("Unexpected end of file")
+			}
+			return nil, err
+		}
+		if !ok {
+			return nil, st.Trap("expected string literal but got '%c'", quote)
+		}
+		raw := raws.Contains(quote)
+		if prefixes.Contains(quote) {
+			q, ok, _ := st.Next(quotes.Contains)
+			if !ok {
+				Restore(st, start)
+				return nil, st.Trap("expected string literal")
+			}
+			quote, raw = q, true
+		}
+		buffer := []byte{}
+		for {
+			pos := Save(st)
+			r, _, err := st.Next(always)
+			if err != nil {
+				if err == io.EOF {
+					return nil, errorAt(start, "unterminated string literal")
+				}
+				return nil, err
+			}
+			switch {
+			case r == quote:
+				return string(buffer), nil
+			case r == '\n' && !raw && !style.Newlines:
+				return nil, errorAt(start, "unterminated string literal")
+			case r < ' ' && style.NoControl && !raw:
+				return nil, errorAt(pos, "invalid control character %U in string literal", r)
+			case r == '\\' && !raw:
+				if buffer, err = style.escape(st, pos, buffer); err != nil {
+					return nil, err
+				}
+			default:
+				buffer = append(buffer, string(r)...)
+			}
+		}
+	})
+}
+
+// escape 处理 pos 处的 \ 之后的转义，把结果追加到 buffer
+func (this StringStyle) escape(st ParseState, pos Checkpoint, buffer []byte) ([]byte, error) {
+	e, _, err := st.Next(always)
+	if err != nil {
+		if err == io.EOF {
+			return nil, errorAt(pos, "unterminated escape sequence")
+		}
+		return nil, err
+	}
+	if s, ok := this.Escapes[e]; ok {
+		return append(buffer, s...), nil
+	}
+	switch {
+	case e == 'x' && this.Hex:
+		value, err := this.hex(st, pos, 2)
+		if err != nil {
+			return nil, err
+		}
+		if this.Bytes {
+			return append(buffer, byte(value)), nil
+		}
+		return append(buffer, string(rune(value))...), nil
+	case e == 'u' && this.Unicode:
+		value, err := this.hex(st, pos, 4)
+		if err != nil {
+			return nil, err
+		}
+		if this.Surrogates && value >= 0xD800 && value < 0xDC00 {
+			value, err = this.lowSurrogate(st, pos, value)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return this.appendRune(st, pos, buffer, value)
+	case e == 'U' && this.Unicode32:
+		value, err := this.hex(st, pos, 8)
+		if err != nil {
+			return nil, err
+		}
+		return this.appendRune(st, pos, buffer, value)
+	case isOctalDigit(e) && this.Octal:
+		value := e - '0'
+		for idx := 1; idx < 3; idx++ {
+			d, ok, _ := st.Next(isOctalDigit)
+			if !ok {
+				if this.Bytes {
+					return nil, errorAt(pos, "octal escape needs exactly 3 digits")
+				}
+				break
+			}
+			value = value*8 + d - '0'
+		}
+		if this.Bytes {
+			if value > 255 {
+				return nil, errorAt(pos, "octal escape value %d > 255", value)
+			}
+			return append(buffer, byte(value)), nil
+		}
+		return append(buffer, string(value)...), nil
+	case this.Lenient:
+		return append(append(buffer, '\\'), string(e)...), nil
+	}
+	return nil, errorAt(pos, "unknown escape sequence \\%c", e)
+}
+
+// hex 读取 size 位十六进制数字
+func (this StringStyle) hex(st ParseState, pos Checkpoint, size int) (rune, error) {
+	var value rune
+	for idx := 0; idx < size; idx++ {
+		d, ok, _ := st.Next(isHexDigit)
+		if !ok {
+			return 0, errorAt(pos, "escape sequence needs %d hex digits", size)
+		}
+		switch {
+		case d >= 'a':
+			d = d - 'a' + 10
+		case d >= 'A':
+			d = d - 'A' + 10
+		default:
+			d = d - '0'
+		}
+		value = value*16 + d
+	}
+	return value, nil
+}
+
+// lowSurrogate 读取 UTF-16 代理对的后半部分，并与 high 组合为一个字符
+func (this StringStyle) lowSurrogate(st ParseState, pos Checkpoint, high rune) (rune, error) {
+	if _, err := String(`\u`)(st); err != nil {
+		return 0, errorAt(pos, "unpaired surrogate \\u%04X", high)
+	}
+	low, err := this.hex(st, pos, 4)
+	if err != nil {
+		return 0, err
+	}
+	if low < 0xDC00 || low > 0xDFFF {
+		return 0, errorAt(pos, "invalid surrogate pair \\u%04X\\u%04X", high, low)
+	}
+	return (high-0xD800)<<10 + (low - 0xDC00) + 0x10000, nil
+}
+
+func (this StringStyle) appendRune(st ParseState, pos Checkpoint, buffer []byte, r rune) ([]byte, error) {
+	if !utf8.ValidRune(r) {
+		return nil, errorAt(pos, "invalid unicode code point %U", r)
+	}
+	return append(buffer, string(r)...), nil
+}
+
+// RuneLiteral 按照 style 匹配只包含一个字符的字面量，返回 rune 。\x 和八进制转义得到
+// 的单个字节按照它的数值返回，例如 '\xff' 是 rune(255) 。
+func RuneLiteral(style StringStyle) Parser {
+	literal := StringLiteral(style)
+	n := *Describe(literal)
+	n.Kind, n.Expected = "runeLiteral", literalExpected("rune", style)
+	return build(&n, func(st ParseState) (interface{}, error) {
+		start := Save(st)
+		value, err := literal(st)
+		if err != nil {
+			return value, err
+		}
+		text := value.(string)
+		if len(text) == 1 {
+			return rune(text[0]), nil
+		}
+		r, size := utf8.DecodeRuneInString(text)
+		if size == 0 || size != len(text) {
+			return nil, errorAt(start, "rune literal must contain exactly one character")
+		}
+		return r, nil
+	})
+}
@@ -0,0 +1,267 @@
+package goparsec
+
+import (
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// NumberFormat 描述数字字面量的语法，它的方法生成返回 int64 、uint64 、float64 、
+// *big.Int 或 *big.Float 的 parser 。
+type NumberFormat struct {
+	// Sign 表示允许开头的 + 或 -
+	Sign bool
+	// Prefixes 表示整数允许 0x 、0o 、0b 前缀（大小写均可）
+	Prefixes bool
+	// Underscores 表示允许在数字之间使用 _ 作为分隔，例如 1_000_000
+	Underscores bool
+	// Overflow 在数值超出目标类型的范围时生成错误，调用时 st 报告的位置是数字开始的
+	// 位置。为 nil 时生成指向数字开始位置的 ParseError 。
+	Overflow func(st ParseState, text, typ string) error
+}
+
+// DefaultNumberFormat 支持符号、进制前缀和 _ 分隔
+var DefaultNumberFormat = NumberFormat{Sign: true, Prefixes: true, Underscores: true}
+
+var (
+	Int64    = DefaultNumberFormat.Int64()
+	Uint64   = DefaultNumberFormat.Uint64()
+	Float64  = DefaultNumberFormat.Float64()
+	BigInt   = DefaultNumberFormat.BigInt()
+	BigFloat = DefaultNumberFormat.BigFloat()
+)
+
+var numberPrefixes = map[string]int{
+	"0x": 16, "0X": 16, "0o": 8, "0O": 8, "0b": 2, "0B": 2,
+}
+var numberPrefix = Keywords("0x", "0X", "0o", "0O", "0b", "0B")
+
+var numberDigits = map[int]func(rune) bool{
+	2:  func(r rune) bool { return r == '0' || r == '1' },
+	8:  func(r rune) bool { return r >= '0' && r <= '7' },
+	10: func(r rune) bool { return r >= '0' && r <= '9' },
+	16: func(r rune) bool { return strings.IndexRune("0123456789abcdefABCDEF", r) >= 0 },
+}
+
+func isSign(r rune) bool {
+	return r == '+' || r == '-'
+}
+
+func isExponent(r rune) bool {
+	return r == 'e' || r == 'E'
+}
+
+// numberText 是扫描得到的数字字面量，text 是去掉了分隔符的原文，digits 不含符号和前缀
+type numberText struct {
+	start    Checkpoint
+	text     string
+	negative bool
+	base     int
+	digits   string
+}
+
+// digits 扫描 base 进制的数字，可以为空
+func (this NumberFormat) digits(st ParseState, base int) (string, error) {
+	pred := numberDigits[base]
+	if this.Underscores {
+		digit := pred
+		pred = func(r rune) bool { return r == '_' || digit(r) }
+	}
+	text, err := takeWhile(st, pred)
+	if err != nil {
+		return "", err
+	}
+	digits := text.(string)
+	if !this.Underscores {
+		return digits, nil
+	}
+	if strings.HasPrefix(digits, "_") || strings.HasSuffix(digits, "_") || strings.Contains(digits, "__") {
+		return "", st.Trap("invalid digit separator in %s", digits)
+	}
+	return strings.Replace(digits, "_", "", -1), nil
+}
+
+// scan 扫描一个数字字面量，float 为 true 时允许小数和指数部分
+func (this NumberFormat) scan(st ParseState, float bool) (numberText, error) {
+	var ret numberText
+	ret.base = 10
+	sign := ""
+	if this.Sign {
+		if r, ok, _ := st.Next(isSign); ok {
+			sign = string(r)
+			ret.negative = r == '-'
+		}
+	}
+	prefix := ""
+	if this.Prefixes && !float {
+		if p, err := numberPrefix(st); err == nil {
+			prefix = p.(string)
+			ret.base = numberPrefixes[prefix]
+		}
+	}
+	digits, err := this.digits(st, ret.base)
+	if err != nil {
+		return ret, err
+	}
+	ret.digits = digits
+	if float {
+		fraction := ""
+		if _, ok, _ := st.Next(equals('.')); ok {
+			if fraction, err = this.digits(st, 10); err != nil {
+				return ret, err
+			}
+			fraction = "." + fraction
+		}
+		if digits == "" && len(fraction) < 2 {
+			return ret, st.Trap("expected digits")
+		}
+		exponent, err := this.exponent(st)
+		if err != nil {
+			return ret, err
+		}
+		ret.digits = digits + fraction + exponent
+	}
+	if ret.digits == "" {
+		return ret, st.Trap("expected digits")
+	}
+	ret.text = sign + prefix + ret.digits
+	return ret, nil
+}
+
+// exponent 扫描指数部分，e 之后没有数字时不消耗输入并返回空串
+func (this NumberFormat) exponent(st ParseState) (string, error) {
+	cp := Save(st)
+	r, ok, _ := st.Next(isExponent)
+	if !ok {
+		return "", nil
+	}
+	exponent := string(r)
+	if s, ok, _ := st.Next(isSign); ok {
+		exponent += string(s)
+	}
+	digits, err := this.digits(st, 10)
+	if err != nil {
+		return "", err
+	}
+	if digits == "" {
+		Restore(st, cp)
+		return "", nil
+	}
+	return exponent + digits, nil
+}
+
+// number 扫描数字并用 convert 转换，扫描失败时不消耗输入
+func (this NumberFormat) number(kind string, float bool,
+	convert func(st ParseState, num numberText) (interface{}, error)) Parser {
+	n := &Node{Kind: kind, first: func(r rune) bool {
+		return numberDigits[10](r) || (this.Sign && isSign(r)) || (float && r == '.')
+	}}
+	return build(n, func(st ParseState) (interface{}, error) {
+		start := Save(st)
+		num, err := this.scan(st, float)
+		if err != nil {
+			Restore(st, start)
+			return nil, err
+		}
+		num.start = start
+		return convert(st, num)
+	})
+}
+
+// overflow 生成指向数字开始位置的溢出错误，st 停在数字结束的位置
+func (this NumberFormat) overflow(st ParseState, num numberText, typ string) error {
+	if this.Overflow != nil {
+		return this.Overflow(stateAt{st, num.start}, num.text, typ)
+	}
+	return errorAt(num.start, "number %s overflows %s", num.text, typ)
+}
+
+// stateAt 把 ParseState 的位置和 Trap 固定在 cp ，用于在不移动 state 的情况下生成指向
+// 之前位置的错误
+type stateAt struct {
+	ParseState
+	cp Checkpoint
+}
+
+func (this stateAt) Line() int {
+	return this.cp.line
+}
+
+func (this stateAt) Column() int {
+	return this.cp.column
+}
+
+func (this stateAt) Pos() int {
+	return this.cp.pos
+}
+
+func (this stateAt) Trap(message string, args ...interface{}) error {
+	return errorAt(this.cp, message, args...)
+}
+
+// bigInt 把整数字面量转换为 *big.Int
+func (num numberText) bigInt() *big.Int {
+	value, _ := new(big.Int).SetString(num.digits, num.base)
+	if num.negative {
+		value.Neg(value)
+	}
+	return value
+}
+
+// Int64 生成返回 int64 的整数 parser
+func (this NumberFormat) Int64() Parser {
+	return this.number("int64", false, func(st ParseState, num numberText) (interface{}, error) {
+		value := num.bigInt()
+		if !value.IsInt64() {
+			return nil, this.overflow(st, num, "int64")
+		}
+		return value.Int64(), nil
+	})
+}
+
+// Uint64 生成返回 uint64 的整数 parser ，负数也视为溢出
+func (this NumberFormat) Uint64() Parser {
+	return this.number("uint64", false, func(st ParseState, num numberText) (interface{}, error) {
+		value := num.bigInt()
+		if !value.IsUint64() {
+			return nil, this.overflow(st, num, "uint64")
+		}
+		return value.Uint64(), nil
+	})
+}
+
+// BigInt 生成返回 *big.Int 的整数 parser
+func (this NumberFormat) BigInt() Parser {
+	return this.number("bigInt", false, func(st ParseState, num numberText) (interface{}, error) {
+		return num.bigInt(), nil
+	})
+}
+
+// Float64 生成返回 float64 的 parser ，接受 1 、1. 、.5 、1.5e-3 这样的十进制写法
+func (this NumberFormat) Float64() Parser {
+	return this.number("float64", true, func(st ParseState, num numberText) (interface{}, error) {
+		text := num.digits
+		if num.negative {
+			text = "-" + text
+		}
+		value, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return nil, this.overflow(st, num, "float64")
+		}
+		return value, nil
+	})
+}
+
+// BigFloat 生成返回 *big.Float 的 parser ，语法与 Float64 相同
+func (this NumberFormat) BigFloat() Parser {
+	return this.number("bigFloat", true, func(st ParseState, num numberText) (interface{}, error) {
+		value, _, err := big.ParseFloat(num.digits, 10, 0, big.ToNearestEven)
+		if err != nil {
+			return nil, this.overflow(st, num, "big.Float")
+		}
+		if num.negative {
+			value.Neg(value)
+		}
+		return value, nil
+	})
+}
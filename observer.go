@@ -0,0 +1,167 @@
+package goparsec
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// Observer 观察解析的过程，挂载在 state 上以后，命名规则在执行前后调用 Enter 和 Exit ，
+// Try 之类的组合子回退已经消耗的输入时调用 Backtrack 。pos 都是 st.Pos() 的位置。
+type Observer interface {
+	Enter(rule string, pos int)
+	Exit(rule string, pos int, value interface{}, err error)
+	Backtrack(from, to int)
+}
+
+// Observable 是 ParseState 可选实现的接口，实现了它的 state 可以挂载 Observer 。
+// 没有挂载 Observer 时，观察点只有一次接口查询和一次原子读取的开销，可以用
+// BenchmarkBacktracking 和 BenchmarkBacktrackingObserved 对比。
+type Observable interface {
+	Observer() Observer
+	SetObserver(observer Observer)
+}
+
+// currentObserver 保存全局的 Observer ，Observer 的实现各不相同，所以用 observerBox
+// 包装以后保存
+var currentObserver atomic.Value
+
+type observerBox struct {
+	observer Observer
+}
+
+// SetObserver 设置全局的 Observer ，它观察所有没有挂载 Observer 的 state ，例如测试中
+// 由被测代码自己创建的 state 。observer 为 nil 时关闭，返回之前的 Observer 。
+func SetObserver(observer Observer) Observer {
+	previous, _ := currentObserver.Swap(observerBox{observer}).(observerBox)
+	return previous.observer
+}
+
+// observerOf 返回 st 上挂载的 Observer ，没有时返回全局的 Observer
+func observerOf(st ParseState) Observer {
+	if o, ok := st.(Observable); ok {
+		if observer := o.Observer(); observer != nil {
+			return observer
+		}
+	}
+	global, _ := currentObserver.Load().(observerBox)
+	return global.observer
+}
+
+// errRulePanic 是规则 panic 时传给 Exit 的错误
+var errRulePanic = errors.New("goparsec: rule panicked")
+
+// ruleRunner 由需要包裹规则执行过程的 Observer 实现，例如在 pprof.Do 中执行规则的
+// Profiler
+type ruleRunner interface {
+	runRule(name string, p Parser, st ParseState) (interface{}, error)
+}
+
+// observe 在 observer 的观察下执行名为 name 的规则 p 。p panic 时 Exit 也会被调用，
+// 收到的错误是 errRulePanic ，这样 Guard 恢复以后 Observer 的 Enter 和 Exit 仍然成对。
+func observe(observer Observer, name string, p Parser, st ParseState) (value interface{}, err error) {
+	observer.Enter(name, st.Pos())
+	done := false
+	defer func() {
+		if done {
+			observer.Exit(name, st.Pos(), value, err)
+		} else {
+			observer.Exit(name, st.Pos(), nil, errRulePanic)
+		}
+	}()
+	if runner, ok := observer.(ruleRunner); ok {
+		value, err = runner.runRule(name, p, st)
+	} else {
+		value, err = p(st)
+	}
+	done = true
+	return value, err
+}
+
+// backtrackObserver 由需要知道回溯发生在哪个 state 上的 Observer 实现，例如按 state
+// 记录正在执行的规则的 Profiler
+type backtrackObserver interface {
+	backtrackOn(st ParseState, from, to int)
+}
+
+// rewind 回到 cp ，回退了已经消耗的输入时通知 st 上的 Observer 和全局的 Profiler
+func rewind(st ParseState, cp Checkpoint) {
+	if from := st.Pos(); from != cp.pos {
+		if observer := observerOf(st); observer != nil {
+			observer.Backtrack(from, cp.pos)
+			if b, ok := observer.(backtrackObserver); ok {
+				b.backtrackOn(st, from, cp.pos)
+			}
+		}
+		if profiler := globalProfiler(); profiler != nil {
+			profiler.backtrackOn(st, from, cp.pos)
+		}
+	}
+	Restore(st, cp)
+}
+
+// branchObserver 由需要知道 Choice 和 Either 选中了哪个分支的 Observer 实现
+type branchObserver interface {
+	branch(n *Node, idx int)
+}
+
+// chosen 通知 st 的 Observer ，n 的第 idx 个分支成功了
+func chosen(st ParseState, n *Node, idx int) {
+	if observer, ok := observerOf(st).(branchObserver); ok {
+		observer.branch(n, idx)
+	}
+}
+
+// Observers 把多个 Observer 合并为一个，按顺序通知每一个 Observer
+func Observers(observers ...Observer) Observer {
+	return multiObserver(observers)
+}
+
+type multiObserver []Observer
+
+func (this multiObserver) Enter(rule string, pos int) {
+	for _, observer := range this {
+		observer.Enter(rule, pos)
+	}
+}
+
+func (this multiObserver) Exit(rule string, pos int, value interface{}, err error) {
+	for _, observer := range this {
+		observer.Exit(rule, pos, value, err)
+	}
+}
+
+func (this multiObserver) Backtrack(from, to int) {
+	for _, observer := range this {
+		observer.Backtrack(from, to)
+	}
+}
+
+// runRule 让其中需要包裹规则的 Observer 依次包裹 p
+func (this multiObserver) runRule(name string, p Parser, st ParseState) (interface{}, error) {
+	run := p
+	for _, observer := range this {
+		if runner, ok := observer.(ruleRunner); ok {
+			inner := run
+			run = func(st ParseState) (interface{}, error) {
+				return runner.runRule(name, inner, st)
+			}
+		}
+	}
+	return run(st)
+}
+
+func (this multiObserver) backtrackOn(st ParseState, from, to int) {
+	for _, observer := range this {
+		if b, ok := observer.(backtrackObserver); ok {
+			b.backtrackOn(st, from, to)
+		}
+	}
+}
+
+func (this multiObserver) branch(n *Node, idx int) {
+	for _, observer := range this {
+		if b, ok := observer.(branchObserver); ok {
+			b.branch(n, idx)
+		}
+	}
+}
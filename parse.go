@@ -0,0 +1,148 @@
+package goparsec
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+)
+
+// Result 是 Parse 和 ParseAll 的结果
+type Result struct {
+	Value interface{}
+	// Pos 、Line 和 Column 是解析结束的位置
+	Pos    int
+	Line   int
+	Column int
+	// Warnings 是解析过程中用 Warn 记录的警告
+	Warnings []ParseError
+}
+
+// parseConfig 保存 ParseOption 设置的选项
+type parseConfig struct {
+	trailing bool
+	ctx      context.Context
+	limits   *Limits
+	user     interface{}
+	observer Observer
+}
+
+// ParseOption 是 Parse 和 ParseAll 的选项
+type ParseOption func(config *parseConfig)
+
+// AllowTrailing 允许解析结束后还有剩余的输入，剩余的输入会作为警告出现在结果中
+func AllowTrailing() ParseOption {
+	return func(config *parseConfig) {
+		config.trailing = true
+	}
+}
+
+// WithLimits 通过 RunContext 在 limits 的限制下解析
+func WithLimits(ctx context.Context, limits Limits) ParseOption {
+	return func(config *parseConfig) {
+		config.ctx = ctx
+		config.limits = &limits
+	}
+}
+
+// WithUserState 设置解析开始时的用户数据
+func WithUserState(value interface{}) ParseOption {
+	return func(config *parseConfig) {
+		config.user = value
+	}
+}
+
+// WithObserver 把 observer 挂载到解析使用的 state 上
+func WithObserver(observer Observer) ParseOption {
+	return func(config *parseConfig) {
+		config.observer = observer
+	}
+}
+
+// Warn 在 st 的当前位置记录一条警告，st 没有实现 Warnings 时忽略。回溯到记录警告之前
+// 的快照时，警告会被丢弃。
+func Warn(st ParseState, message string, args ...interface{}) {
+	if w, ok := st.(Warnings); ok {
+		w.AddWarning(ParseError{
+			Line:    st.Line(),
+			Column:  st.Column(),
+			Pos:     st.Pos(),
+			Message: fmt.Sprintf(message, args...),
+		})
+	}
+}
+
+// Guard 执行 p ，把 p 中的 panic（例如语义动作中错误的类型断言）转换为当前位置的
+// ParseError ，它的 Stack 字段保存 panic 时的调用栈。
+func Guard(p Parser) Parser {
+	n := &Node{Kind: "guard", Children: []Parser{p}}
+	return nest(n, func(st ParseState) (value interface{}, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				value = nil
+				err = ParseError{
+					Line:    st.Line(),
+					Column:  st.Column(),
+					Pos:     st.Pos(),
+					Message: fmt.Sprintf("panic: %v", r),
+					Stack:   string(debug.Stack()),
+				}
+			}
+		}()
+		return p(st)
+	})
+}
+
+// Parse 用 p 解析 input ，默认要求消耗全部的输入。p 通过 Guard 执行，其中的 panic
+// 会转换为 ParseError 。出错时返回的 Result 记录了停止的位置。
+func Parse(p Parser, input string, opts ...ParseOption) (Result, error) {
+	return run(p, input, opts)
+}
+
+// ParseAll 反复用 p 解析 input 直到输入结束，Result.Value 是所有结果组成的
+// []interface{} 。p 成功但是没有消耗输入时返回错误。
+func ParseAll(p Parser, input string, opts ...ParseOption) (Result, error) {
+	all := func(st ParseState) (interface{}, error) {
+		return many(st, "ParseAll", p, []interface{}{})
+	}
+	return run(all, input, opts)
+}
+
+func run(p Parser, input string, opts []ParseOption) (Result, error) {
+	config := parseConfig{}
+	for _, opt := range opts {
+		opt(&config)
+	}
+	st := MemoryParseState(input)
+	if config.user != nil {
+		st.(UserState).SetUserData(config.user)
+	}
+	if config.observer != nil {
+		st.(Observable).SetObserver(config.observer)
+	}
+	parser := p
+	if config.trailing {
+		parser = Bind(p, func(value interface{}) Parser {
+			return func(st ParseState) (interface{}, error) {
+				if _, err := Eof(st); err != nil {
+					Warn(st, "unparsed input remains")
+				}
+				return value, nil
+			}
+		})
+	} else {
+		parser = Bind(p, func(value interface{}) Parser {
+			return Bind_(Eof, Return(value))
+		})
+	}
+	parser = Guard(parser)
+	var result Result
+	var err error
+	if config.limits != nil {
+		result.Value, err = RunContext(config.ctx, parser, st, *config.limits)
+	} else {
+		result.Value, err = parser(st)
+	}
+	result.Pos, result.Line, result.Column = st.Pos(), st.Line(), st.Column()
+	result.Warnings = st.(Warnings).Warnings()
+	return result, err
+}
@@ -3,24 +3,62 @@
 // 但是我需要一个面向 unicode 的简洁实现，所以只好重写了自己的版本。
 package goparsec
 
+import "fmt"
+
 type Parser func(ParseState) (interface{}, error)
 
 // 因为几个基础的 parser 获取到的是 []interface{} ，内部保存 rune 。所以经常遇到传递出来的
 // inteface{} 要转为 []interface{} ，再转成 []rune ，再转 string 的情况，所以这里提供两个
 // 工具函数。
 
-// func ExtraString 将 interface{} 转成 string，如果输入数据与前面提到的规范不符，会 panic
+// TypeError 表示数据的类型与预期不符，Pos 是出错的位置，无法确定时为 -1
+type TypeError struct {
+	Type  string
+	Value interface{}
+	Pos   int
+}
+
+func (this TypeError) Error() string {
+	return fmt.Sprintf("pos %d: expect %v as a %s", this.Pos, this.Value, this.Type)
+}
+
+// func ExtraString 将 interface{} 转成 string，如果输入数据与前面提到的规范不符，会以
+// TypeError panic 。不希望 panic 时使用 TryExtractString 。
 func ExtractString(input interface{}) string {
-	data := input.([]interface{})
-	l := len(data)
-	buffer := make([]rune, l)
+	s, err := TryExtractString(input)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// TryExtractString 与 ExtractString 相同，但是输入数据不符合规范时返回 TypeError
+func TryExtractString(input interface{}) (string, error) {
+	data, ok := input.([]interface{})
+	if !ok {
+		return "", TypeError{"[]interface{}", input, -1}
+	}
+	buffer := make([]rune, len(data))
 	for index, item := range data {
-		buffer[index] = item.(rune)
+		r, ok := item.(rune)
+		if !ok {
+			return "", TypeError{"rune", item, -1}
+		}
+		buffer[index] = r
 	}
-	return string(buffer)
+	return string(buffer), nil
 }
 
-// func ReturnString 用 Return 包装 ExtraString，使其适用于 Bind 这样的组合子。
+// func ReturnString 用 Return 包装 ExtraString，使其适用于 Bind 这样的组合子。input 不
+// 符合规范时返回的 parser 以当前位置的 TypeError 失败。
 func ReturnString(input interface{}) Parser {
-	return Return(ExtractString(input))
+	return func(st ParseState) (interface{}, error) {
+		s, err := TryExtractString(input)
+		if err != nil {
+			typeErr := err.(TypeError)
+			typeErr.Pos = st.Pos()
+			return nil, typeErr
+		}
+		return s, nil
+	}
 }
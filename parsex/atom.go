@@ -110,12 +110,12 @@ func Str(s string) Parser {
 // parsex 的 String 尝试匹配 State 的下一个 Token，这与 parsec 不同
 func String(s string) Parser {
 	return func(st ParsexState) (interface{}, error) {
-		pos := st.Pos()
+		cp := Save(st)
 
 		// try and match string
 		_, err := st.Next(equals(s))
 		if err != nil {
-			st.SeekTo(pos)
+			Restore(st, cp)
 			return nil, err
 		}
 		return s, nil
@@ -337,7 +337,11 @@ func RuneChecker(checker func(int, interface{}) (interface{}, error), expected s
 }
 
 var Space = RuneChecker(func(pos int, x interface{}) (interface{}, error) {
-	if unicode.IsSpace(x.(rune)) {
+	r, ok := x.(rune)
+	if !ok {
+		return x, TypeError{"rune", x, pos}
+	}
+	if unicode.IsSpace(r) {
 		return x, nil
 	} else {
 		message := fmt.Sprintf("expect space but got %v", x)
@@ -348,17 +352,21 @@ var Spaces = Skip(Space)
 var NewLineRunes = []interface{}{"\r", "\n"}
 var NewLine = OneOf(NewLineRunes)
 var Digit = RuneChecker(func(pos int, x interface{}) (interface{}, error) {
-	if unicode.IsDigit(x.(rune)) {
+	r, ok := x.(rune)
+	if !ok {
+		return x, TypeError{"rune", x, pos}
+	}
+	if unicode.IsDigit(r) {
 		return x, nil
 	} else {
-		message := fmt.Sprintf("expect space but got %v", x)
+		message := fmt.Sprintf("expect digit but got %v", x)
 		return x, errors.New(message)
 	}
 }, "digit")
 var Eol = Either(Eof, NewLine)
 
 func Int(st ParsexState) (interface{}, error) {
-	pos := st.Pos()
+	cp := Save(st)
 	values := []interface{}{}
 	_, err := Try(Rune('-'))(st)
 	if err == nil {
@@ -367,9 +375,9 @@ func Int(st ParsexState) (interface{}, error) {
 	v, err := Many1(Digit)(st)
 	if err == nil {
 		values = append(values, v.([]interface{})...)
-		return ExtractString(values), nil
+		return TryExtractString(values)
 	} else {
-		st.SeekTo(pos)
+		Restore(st, cp)
 		return nil, err
 	}
 }
@@ -384,7 +392,7 @@ var UnsignedFloat = Bind(Many(Digit), func(input interface{}) Parser {
 		ret = append(ret, input.([]interface{})...)
 		ret = append(ret, '.')
 		ret = append(ret, value.([]interface{})...)
-		return ExtractString(ret), nil
+		return TryExtractString(ret)
 	}
 })
 
@@ -392,8 +400,7 @@ var Float = Either(UnsignedFloat,
 	Bind_(Rune('-'), func(st ParsexState) (interface{}, error) {
 		value, err := UnsignedFloat(st)
 		if err == nil {
-			return ExtractString(append([]interface{}{'-'},
-				value.([]interface{})...)), nil
+			return "-" + value.(string), nil
 		} else {
 			return nil, err
 		}
@@ -18,12 +18,12 @@ func indexer(data []interface{}) func(x interface{}) int {
 
 func Try(parser Parser) Parser {
 	return func(st ParsexState) (interface{}, error) {
-		pos := st.Pos()
+		cp := Save(st)
 		result, err := parser(st)
 		if err == nil {
 			return result, nil
 		} else {
-			st.SeekTo(pos)
+			Restore(st, cp)
 			return nil, err
 		}
 	}
@@ -52,11 +52,13 @@ func Bind_(parserx, parsery Parser) Parser {
 func Either(parserx, parsery Parser) Parser {
 	return func(st ParsexState) (interface{}, error) {
 		pos := st.Pos()
+		cp := Save(st)
 		x, err := parserx(st)
 		if err == nil {
 			return x, nil
 		} else {
 			if st.Pos() == pos {
+				Restore(st, cp)
 				return parsery(st)
 			}
 		}
@@ -73,18 +75,46 @@ func Option(v interface{}, parser Parser) Parser {
 		return Either(parser, Return(v))(st)
 	}
 }
+
+// noProgress 用于重复类的组合子，内部的 parser 成功但是没有消耗输入时，继续重复只会
+// 陷入死循环，所以报错退出。
+func noProgress(st ParsexState, combinator string) error {
+	return st.Trap("%s: parser succeeded without consuming input, repeating it would loop forever",
+		combinator)
+}
+
+// many 从 values 开始持续执行 parser，直到它不消耗输入地失败
+func many(st ParsexState, combinator string, parser Parser, values []interface{}) (interface{}, error) {
+	for {
+		pos := st.Pos()
+		cp := Save(st)
+		value, err := parser(st)
+		if err != nil {
+			if st.Pos() == pos {
+				Restore(st, cp)
+				return values, nil
+			}
+			return nil, err
+		}
+		if st.Pos() == pos {
+			return nil, noProgress(st, combinator)
+		}
+		values = append(values, value)
+	}
+}
+
 func Many1(parser Parser) Parser {
-	head := func(value interface{}) Parser {
-		tail := func(values interface{}) Parser {
-			return Return(append([]interface{}{value}, values.([]interface{})...))
+	return func(st ParsexState) (interface{}, error) {
+		value, err := parser(st)
+		if err != nil {
+			return nil, err
 		}
-		return Bind(Many(parser), tail)
+		return many(st, "Many1", parser, []interface{}{value})
 	}
-	return Bind(parser, head)
 }
 func Many(parser Parser) Parser {
 	return func(st ParsexState) (interface{}, error) {
-		return Option([]interface{}{}, Many1(parser))(st)
+		return many(st, "Many", parser, []interface{}{})
 	}
 }
 func Fail(message string) Parser {
@@ -133,33 +163,61 @@ func Between(start, end, p Parser) Parser {
 	return Bind_(start, Bind(p, keep))
 }
 func SepBy1(p, sep Parser) Parser {
-	head := func(x interface{}) Parser {
-		tail := func(xs interface{}) Parser {
-			return Return(append([]interface{}{x}, xs.([]interface{})...))
+	next := Bind_(sep, p)
+	return func(st ParsexState) (interface{}, error) {
+		x, err := p(st)
+		if err != nil {
+			return nil, err
 		}
-		return Bind(Many(Bind_(sep, p)), tail)
+		return many(st, "SepBy1", next, []interface{}{x})
 	}
-	return Bind(p, head)
 }
 func SepBy(p, sep Parser) Parser {
 	return Option([]interface{}{}, SepBy1(p, sep))
 }
 func ManyTil(p, end Parser) Parser {
-	head := func(x interface{}) Parser {
-		tail := func(xs interface{}) Parser {
-			return Return(append([]interface{}{x}, xs.([]interface{})...))
+	term := Try(end)
+	return func(st ParsexState) (interface{}, error) {
+		values := []interface{}{}
+		for {
+			pos := st.Pos()
+			if _, err := term(st); err == nil {
+				return values, nil
+			}
+			x, err := p(st)
+			if err != nil {
+				return nil, err
+			}
+			if st.Pos() == pos {
+				return nil, noProgress(st, "ManyTil")
+			}
+			values = append(values, x)
 		}
-
-		return Bind(ManyTil(p, end), tail)
 	}
-	term := Bind_(Try(end), Return([]interface{}{}))
-	return Either(term, Bind(p, head))
 }
 func Maybe(p Parser) Parser {
 	return Option(nil, Bind_(p, Return(nil)))
 }
+
+// Skip 跳过 p 的零次或多次匹配，与 Many 一样，p 成功但不消耗输入时报错
 func Skip(p Parser) Parser {
-	return Maybe(Many(p))
+	return func(st ParsexState) (interface{}, error) {
+		for {
+			pos := st.Pos()
+			cp := Save(st)
+			_, err := p(st)
+			if err != nil {
+				if st.Pos() == pos {
+					Restore(st, cp)
+					return nil, nil
+				}
+				return nil, err
+			}
+			if st.Pos() == pos {
+				return nil, noProgress(st, "Skip")
+			}
+		}
+	}
 }
 
 func Union(parsers ...Parser) Parser {
@@ -196,3 +196,55 @@ func TestFromTo0(t *testing.T) {
 		t.Fatalf("expect create a duration checker from %v to %v but failed: %v", yesterday, now, err)
 	}
 }
+
+func TestManyNoProgress(t *testing.T) {
+	state := NewStateInMemory([]interface{}{"from", now})
+	_, err := Many(Maybe(String("to")))(state)
+	if err == nil {
+		t.Fatalf("expect Many(Maybe(to)) failed without consuming input but it success")
+	}
+}
+
+func TestCheckpoint(t *testing.T) {
+	st := NewStateInMemory([]interface{}{"a", "b"})
+	cp := st.Checkpoint()
+	if _, err := Try(Bind_(String("a"), String("c")))(st); err == nil {
+		t.Fatalf("expect fail at c")
+	}
+	if st.Pos() != 0 {
+		t.Fatalf("expect Try restore to 0 but %d", st.Pos())
+	}
+	String("a")(st)
+	st.Restore(cp)
+	if st.Pos() != 0 {
+		t.Fatalf("expect restore to 0 but %d", st.Pos())
+	}
+}
+
+func TestPanicFree(t *testing.T) {
+	st := NewStateInMemory([]interface{}{"a", 1})
+	if err := st.Seek(-1); err == nil {
+		t.Fatalf("expect SeekError")
+	} else if _, ok := err.(SeekError); !ok {
+		t.Fatalf("expect SeekError but %v", err)
+	}
+	if _, err := Space(st); err == nil {
+		t.Fatalf("expect Space fail on string token")
+	} else if e, ok := err.(TypeError); !ok || e.Pos != 0 {
+		t.Fatalf("expect TypeError at 0 but %v", err)
+	}
+	if _, err := Digit(st); err == nil {
+		t.Fatalf("expect Digit fail on string token")
+	}
+	if _, err := TryExtractString("a"); err == nil {
+		t.Fatalf("expect TypeError from TryExtractString")
+	}
+}
+
+func TestNegativeFloat(t *testing.T) {
+	st := NewStateInMemory([]interface{}{'-', '1', '.', '5'})
+	val, err := Float(st)
+	if err != nil || val != "-1.5" {
+		t.Fatalf("expect -1.5 but %v, %v", val, err)
+	}
+}
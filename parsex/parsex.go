@@ -14,9 +14,22 @@ type Parser func(ParsexState) (interface{}, error)
 // inteface{} 要转为 []string 再转 string 的情况，所以这里提供两个
 // 工具函数。
 
-// func ExtraString 将 interface{} 转成 string，如果输入数据与前面提到的规范不符，会 panic
+// func ExtraString 将 interface{} 转成 string，如果输入数据与前面提到的规范不符，会以
+// TypeError panic 。不希望 panic 时使用 TryExtractString 。
 func ExtractString(input interface{}) string {
-	data := input.([]interface{})
+	s, err := TryExtractString(input)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// TryExtractString 与 ExtractString 相同，但是输入数据不符合规范时返回 TypeError
+func TryExtractString(input interface{}) (string, error) {
+	data, ok := input.([]interface{})
+	if !ok {
+		return "", TypeError{"[]interface{}", input, -1}
+	}
 	l := len(data)
 	buffer := make([]string, l)
 	for index, item := range data {
@@ -29,10 +42,19 @@ func ExtractString(input interface{}) string {
 			buffer[index] = fmt.Sprintf("%v", it)
 		}
 	}
-	return strings.Join(buffer, "")
+	return strings.Join(buffer, ""), nil
 }
 
-// func ReturnString 用 Return 包装 ExtraString，使其适用于 Bind 这样的组合子。
+// func ReturnString 用 Return 包装 ExtraString，使其适用于 Bind 这样的组合子。input 不
+// 符合规范时返回的 parser 以当前位置的 TypeError 失败。
 func ReturnString(input interface{}) Parser {
-	return Return(ExtractString(input))
+	return func(st ParsexState) (interface{}, error) {
+		s, err := TryExtractString(input)
+		if err != nil {
+			typeErr := err.(TypeError)
+			typeErr.Pos = st.Pos()
+			return nil, typeErr
+		}
+		return s, nil
+	}
 }
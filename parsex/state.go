@@ -3,7 +3,6 @@
 package parsex
 
 import (
-	"errors"
 	"fmt"
 	"io"
 )
@@ -18,6 +17,40 @@ func (err ParsexError) Error() string {
 		err.Pos, err.Message)
 }
 
+// Checkpoint 是 ParsexState 在某个时刻的快照，由 Save 生成，交给 Restore 恢复。它对
+// 使用者是不透明的，只能读取快照时的位置。
+type Checkpoint struct {
+	pos int
+	// data 保存 Checkpointer 的实现需要的其它状态，例如 channel 中已经读取的 token
+	data interface{}
+}
+
+// NewCheckpoint 记录 st 当前的位置，data 是 st 恢复时需要的其它状态。它用于实现
+// Checkpointer 。
+func NewCheckpoint(st ParsexState, data interface{}) Checkpoint {
+	return Checkpoint{st.Pos(), data}
+}
+
+// Pos 返回快照时的位置
+func (cp Checkpoint) Pos() int {
+	return cp.pos
+}
+
+// Data 返回 NewCheckpoint 时保存的状态
+func (cp Checkpoint) Data() interface{} {
+	return cp.data
+}
+
+// SeekError 表示 Seek 或 SeekTo 的目标位置超出了输入的范围 [0, Size]
+type SeekError struct {
+	Pos  int
+	Size int
+}
+
+func (err SeekError) Error() string {
+	return fmt.Sprintf("%d out range [0, %d]", err.Pos, err.Size)
+}
+
 type ParsexState interface {
 	Next(pred func(int, interface{}) (interface{}, error)) (x interface{}, err error)
 	Pos() int
@@ -25,6 +58,32 @@ type ParsexState interface {
 	Trap(message string, args ...interface{}) error
 }
 
+// Checkpointer 是 ParsexState 可选实现的快照接口，组合子通过 Save 和 Restore 回溯时
+// 会优先使用它，所以不能随机访问的 token 源也可以通过它回溯。
+type Checkpointer interface {
+	Checkpoint() Checkpoint
+	// Restore 回到 cp 时的状态，它只用于回溯到之前的快照
+	Restore(cp Checkpoint)
+}
+
+// Save 返回 st 当前的快照，st 没有实现 Checkpointer 时快照只有位置
+func Save(st ParsexState) Checkpoint {
+	if c, ok := st.(Checkpointer); ok {
+		return c.Checkpoint()
+	}
+	return Checkpoint{pos: st.Pos()}
+}
+
+// Restore 把 st 恢复到 Save 返回的快照 cp ，st 没有实现 Checkpointer 时用 SeekTo 回到
+// cp 的位置
+func Restore(st ParsexState, cp Checkpoint) {
+	if c, ok := st.(Checkpointer); ok {
+		c.Restore(cp)
+		return
+	}
+	st.SeekTo(cp.pos)
+}
+
 type StateInMemory struct {
 	buffer []interface{}
 	pos    int
@@ -54,13 +113,29 @@ func (this *StateInMemory) Pos() int {
 	return (*this).pos
 }
 
+// SeekTo 跳转到 pos 位置，超出输入的范围时以 SeekError panic 。不希望 panic 时使用 Seek 。
 func (this *StateInMemory) SeekTo(pos int) {
+	if err := this.Seek(pos); err != nil {
+		panic(err)
+	}
+}
+
+// Seek 跳转到 pos 位置，超出输入的范围时不移动并返回 SeekError
+func (this *StateInMemory) Seek(pos int) error {
 	end := len((*this).buffer)
 	if pos < 0 || pos > end {
-		message := fmt.Sprintf("%d out range [0, %d]", pos, end)
-		panic(errors.New(message))
+		return SeekError{pos, end}
 	}
 	(*this).pos = pos
+	return nil
+}
+
+func (this *StateInMemory) Checkpoint() Checkpoint {
+	return Checkpoint{pos: (*this).pos}
+}
+
+func (this *StateInMemory) Restore(cp Checkpoint) {
+	(*this).pos = cp.pos
 }
 
 func (this *StateInMemory) Trap(message string, args ...interface{}) error {
@@ -0,0 +1,207 @@
+package goparsec
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"runtime/pprof"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+)
+
+// RuleStats 是一个命名规则的统计信息
+type RuleStats struct {
+	Rule      string
+	Calls     int
+	Successes int
+	Failures  int
+	// Backtrack 是规则执行期间 Try 之类的组合子回退的字符数之和，这些输入随后会被
+	// 重新读取。回退记在发生时最内层的规则上，嵌套规则中的回退不计入外层的规则。
+	Backtrack int
+	// Time 是规则累计的执行时间，包括其中嵌套执行的规则
+	Time time.Duration
+}
+
+// Profiler 统计每个命名规则的调用次数、成功和失败的次数、回溯的距离和累计时间。它
+// 实现了 Observer ，可以用 SetProfiler 全局打开，也可以只挂载到某个 state 上。统计
+// 可以在多个 goroutine 中同时进行。
+type Profiler struct {
+	// Labels 为 true 时，规则在 pprof.Do 中执行，CPU profile 的样本带有 rule 标签，
+	// 可以用 go tool pprof -tagfocus rule=... 查看某个规则。这时 Profiler 记录嵌套
+	// 规则的标签，只能在一个 goroutine 中使用。
+	Labels bool
+	// Context 是 rule 标签的起点，最外层的规则结束后 goroutine 回到它的标签。调用者
+	// 自己设置了标签时应该传入 pprof.Do 得到的 ctx ，为 nil 时使用 context.Background() 。
+	Context context.Context
+	mu      sync.Mutex
+	stats   map[string]*RuleStats
+	// running 保存每个 state 上正在执行的规则，并发的解析使用不同的 state
+	running map[ParseState][]string
+	labels  []context.Context
+}
+
+func NewProfiler() *Profiler {
+	return &Profiler{stats: map[string]*RuleStats{}, running: map[ParseState][]string{}}
+}
+
+// currentProfiler 保存全局的 *Profiler ，为 nil 表示没有打开统计
+var currentProfiler atomic.Value
+
+// globalProfiler 返回全局的 Profiler
+func globalProfiler() *Profiler {
+	profiler, _ := currentProfiler.Load().(*Profiler)
+	return profiler
+}
+
+// SetProfiler 打开全局统计，所有的命名规则都记录到 profiler ，profiler 为 nil 时关闭。
+// 返回之前的 Profiler 。
+func SetProfiler(profiler *Profiler) *Profiler {
+	previous, _ := currentProfiler.Swap(profiler).(*Profiler)
+	return previous
+}
+
+// Reset 清除所有的统计
+func (this *Profiler) Reset() {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.stats = map[string]*RuleStats{}
+}
+
+// Stats 返回所有规则的统计，按累计时间从多到少排列，时间相同时按调用次数排列
+func (this *Profiler) Stats() []RuleStats {
+	this.mu.Lock()
+	ret := make([]RuleStats, 0, len(this.stats))
+	for _, stats := range this.stats {
+		ret = append(ret, *stats)
+	}
+	this.mu.Unlock()
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Time != ret[j].Time {
+			return ret[i].Time > ret[j].Time
+		}
+		if ret[i].Calls != ret[j].Calls {
+			return ret[i].Calls > ret[j].Calls
+		}
+		return ret[i].Rule < ret[j].Rule
+	})
+	return ret
+}
+
+// WriteReport 把 Stats 的结果以表格的形式写到 w
+func (this *Profiler) WriteReport(w io.Writer) error {
+	table := tabwriter.NewWriter(w, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(table, "rule\tcalls\tok\tfail\tbacktrack\ttime\tavg\t")
+	for _, stats := range this.Stats() {
+		fmt.Fprintf(table, "%s\t%d\t%d\t%d\t%d\t%v\t%v\t\n", stats.Rule, stats.Calls,
+			stats.Successes, stats.Failures, stats.Backtrack, stats.Time,
+			stats.Time/time.Duration(stats.Calls))
+	}
+	return table.Flush()
+}
+
+// runRule 执行名为 name 的规则 p 并记录统计，Labels 为 true 时 p 在 pprof.Do 中执行
+func (this *Profiler) runRule(name string, p Parser, st ParseState) (value interface{}, err error) {
+	begin, ok := time.Now(), false
+	keyed := stateKeyed(st)
+	if keyed {
+		this.enter(st, name)
+	}
+	defer func() {
+		if keyed {
+			this.leave(st)
+		}
+		this.record(name, time.Since(begin), ok)
+	}()
+	if this.Labels {
+		parent := this.Context
+		if len(this.labels) > 0 {
+			parent = this.labels[len(this.labels)-1]
+		} else if parent == nil {
+			parent = context.Background()
+		}
+		pprof.Do(parent, pprof.Labels("rule", name), func(ctx context.Context) {
+			this.labels = append(this.labels, ctx)
+			defer func() {
+				this.labels = this.labels[:len(this.labels)-1]
+			}()
+			value, err = p(st)
+		})
+	} else {
+		value, err = p(st)
+	}
+	ok = err == nil
+	return value, err
+}
+
+// stateKeyed 判断 st 能否作为 running 的键，不能比较的 state 不记录回溯
+func stateKeyed(st ParseState) bool {
+	return reflect.TypeOf(st).Comparable()
+}
+
+// rule 返回 rule 的统计，调用者需要持有 mu
+func (this *Profiler) rule(rule string) *RuleStats {
+	stats, found := this.stats[rule]
+	if !found {
+		stats = &RuleStats{Rule: rule}
+		this.stats[rule] = stats
+	}
+	return stats
+}
+
+// enter 记录 st 上开始执行的规则
+func (this *Profiler) enter(st ParseState, rule string) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.running[st] = append(this.running[st], rule)
+}
+
+// leave 记录 st 上最内层的规则执行结束
+func (this *Profiler) leave(st ParseState) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if rules := this.running[st]; len(rules) > 1 {
+		this.running[st] = rules[:len(rules)-1]
+	} else {
+		delete(this.running, st)
+	}
+}
+
+// record 记录一次规则的执行，panic 的执行记为失败
+func (this *Profiler) record(rule string, elapsed time.Duration, ok bool) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	stats := this.rule(rule)
+	stats.Calls++
+	stats.Time += elapsed
+	if ok {
+		stats.Successes++
+	} else {
+		stats.Failures++
+	}
+}
+
+// backtrackOn 把 st 上从 from 回退到 to 的距离记在 st 上最内层的规则上
+func (this *Profiler) backtrackOn(st ParseState, from, to int) {
+	if !stateKeyed(st) {
+		return
+	}
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if rules := this.running[st]; len(rules) > 0 {
+		this.rule(rules[len(rules)-1]).Backtrack += from - to
+	}
+}
+
+// Enter 实现 Observer 。统计在 Rule 执行规则时完成，这里不需要记录。
+func (this *Profiler) Enter(rule string, pos int) {}
+
+// Exit 实现 Observer 。统计在 Rule 执行规则时完成，这里不需要记录。
+func (this *Profiler) Exit(rule string, pos int, value interface{}, err error) {}
+
+// Backtrack 实现 Observer 。同一个 Profiler 可以同时统计多个 state ，回溯的距离要记在
+// 回溯发生的 state 上正在执行的规则上，所以由同时收到 state 的 backtrackOn 记录。
+func (this *Profiler) Backtrack(from, to int) {}
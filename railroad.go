@@ -0,0 +1,272 @@
+package goparsec
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// 铁路图的布局参数，单位是像素
+const (
+	// railUnit 是连线的转弯半径，也是元素之间的间隔
+	railUnit = 10.0
+	// railCharWidth 是等宽字体中一个字符的宽度
+	railCharWidth = 8.0
+	// railHalfHeight 是方框高度的一半
+	railHalfHeight = 11.0
+	// railGap 是上下排列的分支之间的间隔
+	railGap = 8.0
+	// railTitle 是每条规则上方标题的高度
+	railTitle = 24.0
+)
+
+const railStyle = `svg.railroad { background: #fff; }
+svg.railroad path, svg.railroad rect { stroke: #333; stroke-width: 1.5; fill: none; }
+svg.railroad rect.literal { fill: #e8f4ff; }
+svg.railroad rect.ref { fill: #fff8e0; }
+svg.railroad rect.comment { stroke-dasharray: 4 3; }
+svg.railroad text { font-family: monospace; font-size: 13px; text-anchor: middle; }
+svg.railroad text.comment { font-style: italic; fill: #666; }
+svg.railroad text.title { font-weight: bold; text-anchor: start; }
+`
+
+// railBox 是一个表达式在铁路图中占据的范围，up 和 down 是连线上方和下方的高度
+type railBox struct {
+	width, up, down float64
+}
+
+// railText 返回文本的显示宽度
+func railText(s string) float64 {
+	return float64(utf8.RuneCountInString(s)) * railCharWidth
+}
+
+// label 返回表达式在方框中显示的文本
+func (this *syntax) label() string {
+	switch this.kind {
+	case "literal":
+		return ebnfLiteral(this.text)
+	case "class":
+		return ebnfClass(this.text, this.negated)
+	default:
+		return this.text
+	}
+}
+
+func (this *syntax) measure() railBox {
+	switch this.kind {
+	case "literal", "class", "ref", "comment":
+		return railBox{railText(this.label()) + 2*railUnit, railHalfHeight, railHalfHeight}
+	case "seq":
+		box := railBox{}
+		for idx, item := range this.items {
+			b := item.measure()
+			if idx > 0 {
+				box.width += railUnit
+			}
+			box.width += b.width
+			box.up = maxFloat(box.up, b.up)
+			box.down = maxFloat(box.down, b.down)
+		}
+		return box
+	case "alt":
+		box := railBox{}
+		for idx, item := range this.items {
+			b := item.measure()
+			box.width = maxFloat(box.width, b.width)
+			if idx == 0 {
+				box.up, box.down = b.up, b.down
+			} else {
+				box.down += railGap + b.up + b.down
+			}
+		}
+		box.width += 4 * railUnit
+		return box
+	case "opt":
+		b := this.items[0].measure()
+		return railBox{b.width + 4*railUnit, maxFloat(b.up+railGap, 2*railUnit), b.down}
+	case "plus":
+		b := this.items[0].measure()
+		return railBox{b.width + 2*railUnit, b.up, maxFloat(b.down+railGap, 2*railUnit)}
+	case "star":
+		return (&syntax{kind: "opt", items: []*syntax{{kind: "plus", items: this.items}}}).measure()
+	default:
+		return railBox{}
+	}
+}
+
+func maxFloat(x, y float64) float64 {
+	if x > y {
+		return x
+	}
+	return y
+}
+
+// railroad 生成 SVG 的内容
+type railroad struct {
+	buf strings.Builder
+}
+
+func (this *railroad) path(format string, args ...interface{}) {
+	fmt.Fprintf(&this.buf, "<path d=\""+format+"\"/>\n", args...)
+}
+
+// line 画一段水平的连线
+func (this *railroad) line(x, y, to float64) {
+	if to > x {
+		this.path("M%g %gH%g", x, y, to)
+	}
+}
+
+// draw 以 y 为连线的高度，从 x 开始画 s ，不足 width 的部分用连线补齐
+func (this *railroad) draw(s *syntax, x, y, width float64) {
+	box := s.measure()
+	switch s.kind {
+	case "literal", "class", "ref", "comment":
+		class := s.kind
+		if class == "class" {
+			class = "literal"
+		}
+		rx := 0.0
+		if class == "literal" {
+			rx = railHalfHeight
+		}
+		if s.kind == "ref" {
+			fmt.Fprintf(&this.buf, "<a href=\"#%s\">", html.EscapeString(s.text))
+		}
+		fmt.Fprintf(&this.buf, "<rect class=\"%s\" x=\"%g\" y=\"%g\" width=\"%g\" height=\"%g\" rx=\"%g\"/>\n",
+			class, x, y-railHalfHeight, box.width, 2*railHalfHeight, rx)
+		textClass := ""
+		if s.kind == "comment" {
+			textClass = ` class="comment"`
+		}
+		fmt.Fprintf(&this.buf, "<text%s x=\"%g\" y=\"%g\">%s</text>\n",
+			textClass, x+box.width/2, y+4, html.EscapeString(s.label()))
+		if s.kind == "ref" {
+			this.buf.WriteString("</a>\n")
+		}
+	case "seq":
+		cursor := x
+		for idx, item := range s.items {
+			if idx > 0 {
+				this.line(cursor, y, cursor+railUnit)
+				cursor += railUnit
+			}
+			w := item.measure().width
+			this.draw(item, cursor, y, w)
+			cursor += w
+		}
+	case "alt":
+		inner := box.width - 4*railUnit
+		left, right := x+railUnit, x+box.width-railUnit
+		branch := y
+		for idx, item := range s.items {
+			b := item.measure()
+			if idx == 0 {
+				this.line(x, y, x+2*railUnit)
+			} else {
+				branch += railGap + b.up
+				this.path("M%g %gQ%g %g %g %gV%gQ%g %g %g %g", x, y, left, y, left, y+railUnit,
+					branch-railUnit, left, branch, left+railUnit, branch)
+				this.path("M%g %gQ%g %g %g %gV%gQ%g %g %g %g", right-railUnit, branch, right, branch,
+					right, branch-railUnit, y+railUnit, right, y, x+box.width, y)
+			}
+			this.draw(item, x+2*railUnit, branch, inner)
+			if idx == 0 {
+				this.line(x+2*railUnit+inner, y, x+box.width)
+			}
+			branch += b.down
+		}
+	case "opt":
+		inner := box.width - 4*railUnit
+		left, right := x+railUnit, x+box.width-railUnit
+		skip := y - box.up
+		this.path("M%g %gQ%g %g %g %gV%gQ%g %g %g %gH%gQ%g %g %g %gV%gQ%g %g %g %g",
+			x, y, left, y, left, y-railUnit, skip+railUnit, left, skip, left+railUnit, skip,
+			right-railUnit, right, skip, right, skip+railUnit, y-railUnit, right, y, x+box.width, y)
+		this.line(x, y, x+2*railUnit)
+		this.draw(s.items[0], x+2*railUnit, y, inner)
+		this.line(x+2*railUnit+inner, y, x+box.width)
+	case "plus":
+		inner := box.width - 2*railUnit
+		loop := y + box.down
+		right := x + box.width
+		this.line(x, y, x+railUnit)
+		this.draw(s.items[0], x+railUnit, y, inner)
+		this.line(x+railUnit+inner, y, right)
+		this.path("M%g %gQ%g %g %g %gV%gQ%g %g %g %gH%gQ%g %g %g %gV%gQ%g %g %g %g",
+			right-railUnit, y, right, y, right, y+railUnit, loop-railUnit, right, loop, right-railUnit, loop,
+			x+railUnit, x, loop, x, loop-railUnit, y+railUnit, x, y, x+railUnit, y)
+	case "star":
+		this.draw(&syntax{kind: "opt", items: []*syntax{{kind: "plus", items: s.items}}}, x, y, box.width)
+	}
+	this.line(x+box.width, y, x+width)
+}
+
+// railroadSVG 把 rules 依次画在一个 SVG 中，每条规则上方是它的名字，名字为空时不画
+// 标题。standalone 为 true 时 SVG 自带样式。
+func railroadSVG(rules []grammarRule, standalone bool) string {
+	this := &railroad{}
+	width, y := 0.0, railUnit
+	for _, rule := range rules {
+		box := rule.body.measure()
+		if rule.name != "" {
+			fmt.Fprintf(&this.buf, "<g id=\"%s\">\n", html.EscapeString(rule.name))
+			fmt.Fprintf(&this.buf, "<text class=\"title\" x=\"%g\" y=\"%g\">%s</text>\n",
+				railUnit, y+railTitle-railGap, html.EscapeString(rule.name))
+			y += railTitle
+		} else {
+			this.buf.WriteString("<g>\n")
+		}
+		y += box.up
+		// 起点和终点画成竖线
+		x := 2 * railUnit
+		this.path("M%g %gv%gM%g %gH%g", x, y-railUnit, 2*railUnit, x, y, x+railUnit)
+		this.draw(rule.body, x+railUnit, y, box.width)
+		end := x + railUnit + box.width
+		this.path("M%g %gH%gM%g %gv%g", end, y, end+railUnit, end+railUnit, y-railUnit, 2*railUnit)
+		this.buf.WriteString("</g>\n")
+		width = maxFloat(width, end+3*railUnit)
+		y += box.down + 2*railUnit
+	}
+	var out strings.Builder
+	fmt.Fprintf(&out, "<svg class=\"railroad\" xmlns=\"http://www.w3.org/2000/svg\" width=\"%g\" height=\"%g\" viewBox=\"0 0 %g %g\">\n",
+		width, y, width, y)
+	if standalone {
+		fmt.Fprintf(&out, "<style>\n%s</style>\n", railStyle)
+	}
+	out.WriteString(this.buf.String())
+	out.WriteString("</svg>\n")
+	return out.String()
+}
+
+// WriteRailroadSVG 把从 start 开始能够到达的命名规则画成铁路图，写成一个独立的 SVG
+// 文件，不依赖外部的脚本和字体。规则的收集方式与 WriteEBNF 相同。
+func WriteRailroadSVG(w io.Writer, start Parser) error {
+	_, err := io.WriteString(w, railroadSVG(collectRules(start), true))
+	return err
+}
+
+// WriteRailroadHTML 把从 start 开始能够到达的命名规则写成一个独立的 HTML 页面，每条
+// 规则有自己的铁路图和 EBNF ，引用其它规则的方框链接到对应的规则。
+func WriteRailroadHTML(w io.Writer, title string, start Parser) error {
+	rules := collectRules(start)
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n",
+		html.EscapeString(title))
+	fmt.Fprintf(&buf, "<style>\nbody { font-family: sans-serif; }\npre { background: #f6f6f6; padding: 8px; }\n%s</style>\n",
+		railStyle)
+	fmt.Fprintf(&buf, "</head>\n<body>\n<h1>%s</h1>\n", html.EscapeString(title))
+	for _, rule := range rules {
+		var text strings.Builder
+		writeEBNF(&text, []grammarRule{rule})
+		fmt.Fprintf(&buf, "<section id=\"%s\">\n<h2>%s</h2>\n", html.EscapeString(rule.name),
+			html.EscapeString(rule.name))
+		buf.WriteString(railroadSVG([]grammarRule{{"", rule.body}}, false))
+		fmt.Fprintf(&buf, "<pre>%s</pre>\n</section>\n", html.EscapeString(text.String()))
+	}
+	buf.WriteString("</body>\n</html>\n")
+	_, err := io.WriteString(w, buf.String())
+	return err
+}
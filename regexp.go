@@ -0,0 +1,87 @@
+package goparsec
+
+import (
+	"io"
+	"regexp"
+	"unicode/utf8"
+)
+
+// stateReader 把 ParseState 包装成 io.RuneReader ，供 regexp 从当前位置开始读取。
+// 它只依赖 Next 、Save 和 Restore ，所以对内存中的 state 和流式的 state 都适用。
+type stateReader struct {
+	st    ParseState
+	runes []rune
+	err   error
+}
+
+func (this *stateReader) ReadRune() (rune, int, error) {
+	r, _, err := this.st.Next(always)
+	if err != nil {
+		this.err = err
+		return 0, 0, err
+	}
+	this.runes = append(this.runes, r)
+	return r, utf8.RuneLen(r), nil
+}
+
+// matchAt 在 st 的当前位置匹配 re ，成功时消耗匹配的内容，返回读取到的文本和子匹配的字节
+// 下标；失败时不消耗输入。
+func matchAt(st ParseState, re *regexp.Regexp, pattern string) (string, []int, error) {
+	start := Save(st)
+	reader := &stateReader{st: st}
+	loc := re.FindReaderSubmatchIndex(reader)
+	Restore(st, start)
+	if reader.err != nil && reader.err != io.EOF {
+		return "", nil, reader.err
+	}
+	if loc == nil {
+		return "", nil, st.Trap("expected match of /%s/", pattern)
+	}
+	text := string(reader.runes)
+	count := utf8.RuneCountInString(text[:loc[1]])
+	for idx := 0; idx < count; idx++ {
+		if _, _, err := st.Next(always); err != nil {
+			return "", nil, err
+		}
+	}
+	return text, loc, nil
+}
+
+// compileAnchored 把 pattern 锚定在输入的开头，pattern 不合法时 panic
+func compileAnchored(pattern string) *regexp.Regexp {
+	return regexp.MustCompile(`^(?:` + pattern + `)`)
+}
+
+// Regexp 用正则表达式 pattern 在当前位置匹配，消耗并返回匹配到的 string 。
+// pattern 不合法时 Regexp 会在构造时 panic 。
+func Regexp(pattern string) Parser {
+	re := compileAnchored(pattern)
+	n := &Node{Kind: "regexp", first: always, empty: re.MatchString("")}
+	return build(n, func(st ParseState) (interface{}, error) {
+		text, loc, err := matchAt(st, re, pattern)
+		if err != nil {
+			return nil, err
+		}
+		return text[:loc[1]], nil
+	})
+}
+
+// RegexpSubmatch 与 Regexp 相同，但是返回 []string ，第 0 项是整个匹配，之后依次是
+// 各个捕获组的内容，没有参与匹配的捕获组为空串。
+func RegexpSubmatch(pattern string) Parser {
+	re := compileAnchored(pattern)
+	n := &Node{Kind: "regexp", first: always, empty: re.MatchString("")}
+	return build(n, func(st ParseState) (interface{}, error) {
+		text, loc, err := matchAt(st, re, pattern)
+		if err != nil {
+			return nil, err
+		}
+		groups := make([]string, len(loc)/2)
+		for idx := range groups {
+			if loc[2*idx] >= 0 {
+				groups[idx] = text[loc[2*idx]:loc[2*idx+1]]
+			}
+		}
+		return groups, nil
+	})
+}
@@ -0,0 +1,30 @@
+package goparsec
+
+// Rule 给 p 起一个名字。命名的规则是 grammar 中可以观察的单位，SetTracer 打开全局跟踪
+// 或者 SetProfiler 打开全局统计后，每个命名规则的执行都会被记录，state 上挂载的
+// Observer 也会收到通知。都没有的时候 Rule 直接执行 p 。
+func Rule(name string, p Parser) Parser {
+	n := &Node{Kind: "rule", Children: []Parser{p}, Label: name}
+	return nest(n, func(st ParseState) (interface{}, error) {
+		tracer, profiler, observer := globalTracer(), globalProfiler(), observerOf(st)
+		if tracer == nil && profiler == nil && observer == nil {
+			return p(st)
+		}
+		parser := p
+		if observer != nil {
+			parser = func(st ParseState) (interface{}, error) {
+				return observe(observer, name, p, st)
+			}
+		}
+		if profiler != nil {
+			observed := parser
+			parser = func(st ParseState) (interface{}, error) {
+				return observe(profiler, name, observed, st)
+			}
+		}
+		if tracer != nil {
+			return tracer.trace(name, parser, st)
+		}
+		return parser(st)
+	})
+}
@@ -0,0 +1,139 @@
+package goparsec
+
+import (
+	"sort"
+	"unicode"
+)
+
+// RuneSet 是在构造 parser 时预先编译好的字符集合。ascii 字符用位图判断，其它字符
+// 在有序的区间和 unicode.RangeTable 中查找，运行时不需要再分配闭包或者扫描字符串。
+type RuneSet struct {
+	ascii  [2]uint64
+	ranges []runeRange
+	tables []*unicode.RangeTable
+	// excepts 中每个集合的补集也属于这个集合，用于 \P{Han} 这样的写法
+	excepts []*RuneSet
+	negate  bool
+}
+
+type runeRange struct {
+	lo, hi rune
+}
+
+// NewRuneSet 用 runes 中的字符构造一个 RuneSet
+func NewRuneSet(runes string) *RuneSet {
+	return new(RuneSet).AddRunes(runes)
+}
+
+// AddRunes 将 runes 中的每个字符加入集合
+func (this *RuneSet) AddRunes(runes string) *RuneSet {
+	for _, r := range runes {
+		this.AddRange(r, r)
+	}
+	return this
+}
+
+// AddRange 将闭区间 [lo, hi] 中的字符加入集合
+func (this *RuneSet) AddRange(lo, hi rune) *RuneSet {
+	// 负数不是合法的字符，不会出现在输入中
+	if lo < 0 {
+		lo = 0
+	}
+	if lo > hi {
+		return this
+	}
+	for ; lo <= hi && lo < 128; lo++ {
+		this.ascii[lo/64] |= 1 << uint(lo%64)
+	}
+	if lo > hi {
+		return this
+	}
+	// 保持 ranges 有序并且互不相交，这样 Contains 可以二分查找
+	ranges := []runeRange{}
+	idx := 0
+	for ; idx < len(this.ranges) && this.ranges[idx].hi < lo-1; idx++ {
+		ranges = append(ranges, this.ranges[idx])
+	}
+	for ; idx < len(this.ranges) && this.ranges[idx].lo <= hi+1; idx++ {
+		if this.ranges[idx].lo < lo {
+			lo = this.ranges[idx].lo
+		}
+		if this.ranges[idx].hi > hi {
+			hi = this.ranges[idx].hi
+		}
+	}
+	ranges = append(ranges, runeRange{lo, hi})
+	this.ranges = append(ranges, this.ranges[idx:]...)
+	return this
+}
+
+// AddTable 将 unicode.RangeTable 中的字符加入集合，例如 unicode.Han
+func (this *RuneSet) AddTable(tables ...*unicode.RangeTable) *RuneSet {
+	for _, table := range tables {
+		for _, r16 := range table.R16 {
+			if r16.Lo >= 128 {
+				break
+			}
+			for r := rune(r16.Lo); r <= rune(r16.Hi) && r < 128; r += rune(r16.Stride) {
+				this.ascii[r/64] |= 1 << uint(r%64)
+			}
+		}
+		this.tables = append(this.tables, table)
+	}
+	return this
+}
+
+// addExcept 将 other 的补集加入集合
+func (this *RuneSet) addExcept(other *RuneSet) *RuneSet {
+	this.ascii[0] |= ^other.ascii[0]
+	this.ascii[1] |= ^other.ascii[1]
+	this.excepts = append(this.excepts, other)
+	return this
+}
+
+// Complement 返回一个新的 RuneSet ，包含所有不在这个集合中的字符。它应该在集合构造
+// 完成之后调用，之后再 Add 的字符会从补集中去掉。
+func (this *RuneSet) Complement() *RuneSet {
+	ret := *this
+	ret.tables = ret.tables[:len(ret.tables):len(ret.tables)]
+	ret.excepts = ret.excepts[:len(ret.excepts):len(ret.excepts)]
+	ret.negate = !this.negate
+	return &ret
+}
+
+// Contains 判断 r 是否在集合中
+func (this *RuneSet) Contains(r rune) bool {
+	return this.contains(r) != this.negate
+}
+
+func (this *RuneSet) contains(r rune) bool {
+	if r >= 0 && r < 128 {
+		return this.ascii[r/64]&(1<<uint(r%64)) != 0
+	}
+	ranges := this.ranges
+	idx := sort.Search(len(ranges), func(i int) bool { return ranges[i].hi >= r })
+	if idx < len(ranges) && ranges[idx].lo <= r {
+		return true
+	}
+	for _, table := range this.tables {
+		if unicode.Is(table, r) {
+			return true
+		}
+	}
+	for _, except := range this.excepts {
+		if !except.Contains(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// OneOfSet 匹配一个在 set 中的字符
+func OneOfSet(set *RuneSet, expected string) Parser {
+	return RuneChecker(set.Contains, expected)
+}
+
+// NoneOfSet 匹配一个不在 set 中的字符
+func NoneOfSet(set *RuneSet, expected string) Parser {
+	return RuneChecker(func(r rune) bool { return !set.Contains(r) }, expected)
+}
@@ -3,9 +3,9 @@
 package goparsec
 
 import (
-	"errors"
 	"fmt"
 	"io"
+	"sort"
 )
 
 type ParseError struct {
@@ -13,6 +13,20 @@ type ParseError struct {
 	Column  int
 	Pos     int
 	Message string
+	// Stack 是 Guard 捕获 panic 时的调用栈，其它错误为空
+	Stack string
+	// Err 是 Where 、BindE 中语义检查返回的原始错误
+	Err error
+}
+
+// SeekError 表示 Seek 或 SeekTo 的目标位置超出了输入的范围 [0, Size]
+type SeekError struct {
+	Pos  int
+	Size int
+}
+
+func (err SeekError) Error() string {
+	return fmt.Sprintf("%d out range [0, %d]", err.Pos, err.Size)
 }
 
 func (err ParseError) Error() string {
@@ -20,6 +34,51 @@ func (err ParseError) Error() string {
 		err.Pos, err.Line, err.Column, err.Message)
 }
 
+// Unwrap 返回语义检查的原始错误，使 errors.Is 和 errors.As 可以找到它
+func (err ParseError) Unwrap() error {
+	return err.Err
+}
+
+// Checkpoint 是 ParseState 在某个时刻的快照，由 Save 生成，交给 Restore 恢复。它对使用
+// 者是不透明的，只能读取快照时的位置和行列。它是值类型，保存和恢复快照不需要分配内存。
+type Checkpoint struct {
+	pos    int
+	line   int
+	column int
+	// indent 是参考缩进，user 是用户数据，warnings 是警告的个数，由 StateInMemory 使用
+	indent   int
+	user     interface{}
+	warnings int
+	// data 保存 Checkpointer 的实现需要的其它状态，例如流式输入的缓冲
+	data interface{}
+}
+
+// NewCheckpoint 记录 st 当前的位置和行列，data 是 st 恢复时需要的其它状态。它用于实现
+// Checkpointer 。
+func NewCheckpoint(st ParseState, data interface{}) Checkpoint {
+	return Checkpoint{pos: st.Pos(), line: st.Line(), column: st.Column(), data: data}
+}
+
+// Pos 返回快照时的位置
+func (cp Checkpoint) Pos() int {
+	return cp.pos
+}
+
+// Line 返回快照时的行号
+func (cp Checkpoint) Line() int {
+	return cp.line
+}
+
+// Column 返回快照时的列号
+func (cp Checkpoint) Column() int {
+	return cp.column
+}
+
+// Data 返回 NewCheckpoint 时保存的状态
+func (cp Checkpoint) Data() interface{} {
+	return cp.data
+}
+
 type ParseState interface {
 	Next(pred func(rune) bool) (r rune, ok bool, err error)
 	Line() int
@@ -29,41 +88,135 @@ type ParseState interface {
 	Trap(message string, args ...interface{}) error
 }
 
+// Checkpointer 是 ParseState 可选实现的快照接口，组合子通过 Save 和 Restore 回溯时会
+// 优先使用它。实现了它的 state 可以在回溯时恢复缩进、用户数据等附加的状态，不能随机
+// 访问的输入源也可以通过它回溯。
+type Checkpointer interface {
+	Checkpoint() Checkpoint
+	// Restore 回到 cp 时的状态。它只用于回溯：cp 之后写入的用户数据和警告会被丢弃，
+	// 不能再用更晚的快照恢复它们。
+	Restore(cp Checkpoint)
+}
+
+// Save 返回 st 当前的快照，st 没有实现 Checkpointer 时快照只有位置和行列
+func Save(st ParseState) Checkpoint {
+	if c, ok := st.(Checkpointer); ok {
+		return c.Checkpoint()
+	}
+	return Checkpoint{pos: st.Pos(), line: st.Line(), column: st.Column()}
+}
+
+// Restore 把 st 恢复到 Save 返回的快照 cp ，st 没有实现 Checkpointer 时用 SeekTo 回到
+// cp 的位置。与 Checkpointer.Restore 一样，它只能回到之前的快照。
+func Restore(st ParseState, cp Checkpoint) {
+	if c, ok := st.(Checkpointer); ok {
+		c.Restore(cp)
+		return
+	}
+	st.SeekTo(cp.pos)
+}
+
+// wrapper 由包装了其它 state 的 state 实现，例如 Span 记录读取内容时使用的 state 。
+// 它不能转发的可选接口可以通过 unwrap 在被包装的 state 上找到。
+type wrapper interface {
+	unwrap() ParseState
+}
+
+// unwrap 返回 st 包装的 state ，st 没有包装其它 state 时返回 nil
+func unwrap(st ParseState) ParseState {
+	if w, ok := st.(wrapper); ok {
+		return w.unwrap()
+	}
+	return nil
+}
+
+// errorAt 返回指向 cp 的 ParseError ，不移动 st
+func errorAt(cp Checkpoint, message string, args ...interface{}) ParseError {
+	return ParseError{
+		Line:    cp.line,
+		Column:  cp.column,
+		Pos:     cp.pos,
+		Message: fmt.Sprintf(message, args...),
+	}
+}
+
+// Scanner 是 ParseState 可选实现的批量扫描接口，实现了它的 state 可以直接在缓冲上
+// 扫描一段连续的输入，TakeWhile 、TakeUntil 和 Span 等 parser 会优先使用它。
+type Scanner interface {
+	// ScanWhile 从当前位置开始消耗所有满足 pred 的字符，返回它们组成的字符串。扫描被
+	// RunContext 的限制中断时返回对应的错误
+	ScanWhile(pred func(rune) bool) (string, error)
+	// ScanUntil 消耗 s 出现之前的所有字符，s 没有出现时不消耗输入并返回 false 。扫描被
+	// RunContext 的限制中断时不消耗输入并返回对应的错误
+	ScanUntil(s string) (string, bool, error)
+	// Text 返回 [from, to) 区间的输入内容
+	Text(from, to int) string
+}
+
+// Indentation 是 ParseState 可选实现的缩进接口，保存缩进敏感的 parser 使用的参考缩进，
+// 即参考位置的列号。
+type Indentation interface {
+	Indent() int
+	SetIndent(column int)
+}
+
+// UserState 是 ParseState 可选实现的用户数据接口，GetState 、PutState 和 ModifyState
+// 通过它读写用户数据。与缩进一样，回溯时由 state 的 Restore 和 Seek 恢复用户数据，
+// 所以用户数据应该当作不可变的值使用，修改时生成新的值。
+type UserState interface {
+	UserData() interface{}
+	SetUserData(value interface{})
+}
+
+// Warnings 是 ParseState 可选实现的警告接口，Warn 通过它记录警告。回溯时，快照之后
+// 记录的警告会被丢弃。
+type Warnings interface {
+	AddWarning(warning ParseError)
+	Warnings() []ParseError
+}
+
+// userEntry 记录在 pos 位置最后一次写入的用户数据。StateInMemory 的每个位置最多保留
+// 一个 userEntry ，Seek 回到 pos 时用户数据是 pos 和它之前最后一次写入的值。
+type userEntry struct {
+	pos   int
+	value interface{}
+}
+
 type StateInMemory struct {
 	buffer   []rune
 	newLines []int
 	line     int
 	column   int
 	pos      int
+	indent   int
+	user     []userEntry
+	warnings []ParseError
+	limits   *limiter
+	observer Observer
 }
 
 func MemoryParseState(data string) ParseState {
 	buffer := ([]rune)(data)
 	newLines := []int{}
-	last := len(buffer) - 1
 	for idx, r := range buffer {
 		if r == '\n' {
 			newLines = append(newLines, idx)
 		}
 	}
-	if buffer[last] != '\n' {
-		newLines = append(newLines, last)
-	}
-	return &StateInMemory{buffer, newLines, 1, 1, 0}
+	return &StateInMemory{buffer, newLines, 1, 1, 0, 1, nil, nil, nil, nil}
 }
 
 func (this *StateInMemory) Next(pred func(rune) bool) (r rune, match bool, err error) {
+	if (*this).limits != nil {
+		if err := (*this).limits.step(this); err != nil {
+			return '\000', false, err
+		}
+	}
 	buffer := (*this).buffer
 	if (*this).pos < len(buffer) {
 		ru := buffer[(*this).pos]
 		if pred(ru) {
-			(*this).pos++
-			if ru == '\r' {
-				(*this).line++
-				(*this).column = 0
-			} else {
-				(*this).column++
-			}
+			this.advance(ru)
 			return ru, true, nil
 		} else {
 			return ru, false, nil
@@ -73,6 +226,64 @@ func (this *StateInMemory) Next(pred func(rune) bool) (r rune, match bool, err e
 	}
 }
 
+// advance 消耗当前位置的字符 ru 并更新行列信息
+func (this *StateInMemory) advance(ru rune) {
+	(*this).pos++
+	if ru == '\n' {
+		(*this).line++
+		(*this).column = 1
+	} else {
+		(*this).column++
+	}
+}
+
+func (this *StateInMemory) ScanWhile(pred func(rune) bool) (string, error) {
+	buffer := (*this).buffer
+	start := (*this).pos
+	for (*this).pos < len(buffer) && pred(buffer[(*this).pos]) {
+		if (*this).limits != nil {
+			if err := (*this).limits.step(this); err != nil {
+				return "", err
+			}
+		}
+		this.advance(buffer[(*this).pos])
+	}
+	return string(buffer[start:(*this).pos]), nil
+}
+
+func (this *StateInMemory) ScanUntil(s string) (string, bool, error) {
+	buffer := (*this).buffer
+	target := []rune(s)
+	start := (*this).pos
+	for idx := start; idx+len(target) <= len(buffer); idx++ {
+		if (*this).limits != nil {
+			if err := (*this).limits.step(this); err != nil {
+				return "", false, err
+			}
+		}
+		if runesHasPrefix(buffer[idx:], target) {
+			for (*this).pos < idx {
+				this.advance(buffer[(*this).pos])
+			}
+			return string(buffer[start:idx]), true, nil
+		}
+	}
+	return "", false, nil
+}
+
+func runesHasPrefix(data, prefix []rune) bool {
+	for idx, r := range prefix {
+		if data[idx] != r {
+			return false
+		}
+	}
+	return true
+}
+
+func (this *StateInMemory) Text(from, to int) string {
+	return string((*this).buffer[from:to])
+}
+
 func (this *StateInMemory) Line() int {
 	return (*this).line
 }
@@ -85,26 +296,135 @@ func (this *StateInMemory) Pos() int {
 	return (*this).pos
 }
 
+// SeekTo 跳转到 pos 位置，超出输入的范围时以 SeekError panic 。不希望 panic 时使用 Seek 。
 func (this *StateInMemory) SeekTo(pos int) {
+	if err := this.Seek(pos); err != nil {
+		panic(err)
+	}
+}
+
+// Seek 跳转到 pos 位置，超出输入的范围时不移动并返回 SeekError
+func (this *StateInMemory) Seek(pos int) error {
 	end := len((*this).buffer)
 	if pos < 0 || pos > end {
-		message := fmt.Sprintf("%d out range [0, %d]", pos, end)
-		panic(errors.New(message))
+		return SeekError{pos, end}
 	}
 	(*this).pos = pos
-	top := len((*this).newLines) - 1
-	for idx, _ := range (*this).newLines {
-		line := top - idx
-		start := (*this).newLines[line]
-		if start < pos {
-			(*this).line = line + 2
-			(*this).column = pos - start
-			return
-		}
+	this.dropUser(pos)
+	this.dropWarnings(pos)
+	// pos 之前的换行符个数就是行号减一
+	line := sort.SearchInts((*this).newLines, pos)
+	(*this).line = line + 1
+	if line == 0 {
+		(*this).column = pos + 1
+	} else {
+		(*this).column = pos - (*this).newLines[line-1]
+	}
+	return nil
+}
+
+func (this *StateInMemory) Checkpoint() Checkpoint {
+	return Checkpoint{
+		pos:      (*this).pos,
+		line:     (*this).line,
+		column:   (*this).column,
+		indent:   (*this).indent,
+		user:     this.UserData(),
+		warnings: len((*this).warnings),
+	}
+}
+
+func (this *StateInMemory) Restore(cp Checkpoint) {
+	(*this).pos = cp.pos
+	(*this).line = cp.line
+	(*this).column = cp.column
+	(*this).indent = cp.indent
+	// 与 Seek 一样丢弃 cp 之后的位置写入的用户数据，快照之后在 cp 的位置写入的值恢复为
+	// 快照时的值
+	this.dropUser(cp.pos)
+	if user := (*this).user; len(user) > 0 && user[len(user)-1].pos == cp.pos {
+		user[len(user)-1].value = cp.user
+	}
+	// 快照之后记录的警告都来自回溯掉的分支，包括没有消耗输入就失败的分支
+	if cp.warnings < len((*this).warnings) {
+		(*this).warnings = (*this).warnings[:cp.warnings]
+	}
+}
+
+func (this *StateInMemory) AddWarning(warning ParseError) {
+	(*this).warnings = append((*this).warnings, warning)
+}
+
+func (this *StateInMemory) Warnings() []ParseError {
+	return (*this).warnings
+}
+
+// dropWarnings 丢弃 pos 之后记录的警告
+func (this *StateInMemory) dropWarnings(pos int) {
+	warnings := (*this).warnings
+	for len(warnings) > 0 && warnings[len(warnings)-1].Pos > pos {
+		warnings = warnings[:len(warnings)-1]
 	}
+	(*this).warnings = warnings
+}
+
+func (this *StateInMemory) limiter() *limiter {
+	return (*this).limits
+}
+
+func (this *StateInMemory) setLimiter(lim *limiter) {
+	(*this).limits = lim
+}
+
+func (this *StateInMemory) Observer() Observer {
+	return (*this).observer
+}
+
+func (this *StateInMemory) SetObserver(observer Observer) {
+	(*this).observer = observer
 }
 
 func (this *StateInMemory) Trap(message string, args ...interface{}) error {
-	return ParseError{(*this).line, (*this).column, (*this).pos,
-		fmt.Sprintf(message, args...)}
+	return ParseError{
+		Line:    (*this).line,
+		Column:  (*this).column,
+		Pos:     (*this).pos,
+		Message: fmt.Sprintf(message, args...),
+	}
+}
+
+func (this *StateInMemory) Indent() int {
+	return (*this).indent
+}
+
+func (this *StateInMemory) SetIndent(column int) {
+	(*this).indent = column
+}
+
+func (this *StateInMemory) UserData() interface{} {
+	user := (*this).user
+	if len(user) == 0 {
+		return nil
+	}
+	return user[len(user)-1].value
+}
+
+// SetUserData 在当前位置写入用户数据。同一个位置之前写入的值只有在这个位置保存的快照
+// 能够回到，快照自己保存了这个值，所以这里直接覆盖，保存的用户数据不会超过输入的长度。
+func (this *StateInMemory) SetUserData(value interface{}) {
+	user := (*this).user
+	if len(user) > 0 && user[len(user)-1].pos == (*this).pos {
+		user[len(user)-1].value = value
+		return
+	}
+	(*this).user = append(user, userEntry{(*this).pos, value})
+}
+
+// dropUser 丢弃 pos 之后的位置写入的用户数据
+func (this *StateInMemory) dropUser(pos int) {
+	user := (*this).user
+	for len(user) > 0 && user[len(user)-1].pos > pos {
+		user = user[:len(user)-1]
+	}
+	(*this).user = user
 }
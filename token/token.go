@@ -0,0 +1,380 @@
+// token 包参考了 Haskell Parsec 的 Text.Parsec.Token ，根据一份 LanguageDef 生成处理
+// 空白、注释、标识符、保留字、字面量和数字的 lexeme parser 。每个 lexeme parser 都会
+// 跳过其后的空白和注释，所以 grammar 中只需要在开头调用一次 WhiteSpace 。
+package token
+
+import (
+	"strings"
+	"unicode"
+
+	. "github.com/Dwarfartisan/goparsec"
+)
+
+// LanguageDef 描述一门语言的词法规则
+type LanguageDef struct {
+	// CommentStart 和 CommentEnd 是块注释的开始和结束标记，为空表示不支持块注释
+	CommentStart string
+	CommentEnd   string
+	// CommentLine 是行注释的开始标记，为空表示不支持行注释
+	CommentLine string
+	// NestedComments 表示块注释可以嵌套
+	NestedComments bool
+	// IdentStart 和 IdentLetter 是标识符首字符和后续字符的集合
+	IdentStart  *RuneSet
+	IdentLetter *RuneSet
+	// OpStart 和 OpLetter 是运算符首字符和后续字符的集合
+	OpStart  *RuneSet
+	OpLetter *RuneSet
+	// ReservedNames 是不能作为标识符的保留字
+	ReservedNames []string
+	// ReservedOpNames 是不能作为普通运算符的保留运算符
+	ReservedOpNames []string
+	// CaseInsensitive 表示保留字和保留运算符不区分大小写
+	CaseInsensitive bool
+	// StringStyle 和 RuneStyle 是字符串和字符字面量的写法，没有设置引号时使用 EmptyDef
+	// 的定义
+	StringStyle StringStyle
+	RuneStyle   StringStyle
+}
+
+// EmptyDef 返回一个没有注释和保留字的 LanguageDef ，标识符由字母或 _ 开头，后续可以是
+// 字母、数字、 _ 或 ' ，字符串和字符字面量使用 Go 的写法，不包括 raw 字符串
+func EmptyDef() LanguageDef {
+	return LanguageDef{
+		IdentStart:  new(RuneSet).AddRunes("_").AddTable(unicode.Letter),
+		IdentLetter: new(RuneSet).AddRunes("_'").AddTable(unicode.Letter, unicode.Digit),
+		OpStart:     NewRuneSet(":!#$%&*+./<=>?@\\^|-~"),
+		OpLetter:    NewRuneSet(":!#$%&*+./<=>?@\\^|-~"),
+		StringStyle: stringStyle,
+		RuneStyle:   GoRuneStyle,
+	}
+}
+
+// JavaStyle 返回 C/Java 风格的 LanguageDef ，支持 // 和 /* */ 注释
+func JavaStyle() LanguageDef {
+	def := EmptyDef()
+	def.CommentStart = "/*"
+	def.CommentEnd = "*/"
+	def.CommentLine = "//"
+	def.IdentStart = new(RuneSet).AddRunes("_$").AddTable(unicode.Letter)
+	def.IdentLetter = new(RuneSet).AddRunes("_$").AddTable(unicode.Letter, unicode.Digit)
+	return def
+}
+
+// TokenParser 是由 LanguageDef 生成的一组 lexeme parser 。它的方法值可以直接作为
+// Parser 使用，例如 tp.Identifier 。
+type TokenParser struct {
+	def        LanguageDef
+	reserved   map[string]bool
+	reservedOp map[string]bool
+
+	whiteSpace    Parser
+	identName     Parser
+	opName        Parser
+	identifier    Parser
+	operator      Parser
+	charLiteral   Parser
+	stringLiteral Parser
+	natural       Parser
+	integer       Parser
+	float         Parser
+	naturalOrFlt  Parser
+	semi          Parser
+	comma         Parser
+	colon         Parser
+	dot           Parser
+}
+
+// NewTokenParser 根据 def 构造 TokenParser ，def 中没有设置的字符集合和字面量写法使用
+// EmptyDef 的定义
+func NewTokenParser(def LanguageDef) *TokenParser {
+	empty := EmptyDef()
+	if def.IdentStart == nil {
+		def.IdentStart = empty.IdentStart
+	}
+	if def.IdentLetter == nil {
+		def.IdentLetter = empty.IdentLetter
+	}
+	if def.OpStart == nil {
+		def.OpStart = empty.OpStart
+	}
+	if def.OpLetter == nil {
+		def.OpLetter = empty.OpLetter
+	}
+	if unquoted(def.StringStyle) {
+		def.StringStyle = empty.StringStyle
+	}
+	if unquoted(def.RuneStyle) {
+		def.RuneStyle = empty.RuneStyle
+	}
+	this := &TokenParser{
+		def:        def,
+		reserved:   map[string]bool{},
+		reservedOp: map[string]bool{},
+	}
+	for _, name := range def.ReservedNames {
+		this.reserved[this.fold(name)] = true
+	}
+	for _, name := range def.ReservedOpNames {
+		this.reservedOp[this.fold(name)] = true
+	}
+	this.whiteSpace = this.buildWhiteSpace()
+	this.identName = Span(Bind_(OneOfSet(def.IdentStart, "identifier"), SkipWhile(def.IdentLetter.Contains)))
+	this.opName = Span(Bind_(OneOfSet(def.OpStart, "operator"), SkipWhile(def.OpLetter.Contains)))
+	this.identifier = this.Lexeme(Try(this.ident))
+	this.operator = this.Lexeme(Try(this.oper))
+	this.charLiteral = this.Lexeme(RuneLiteral(def.RuneStyle))
+	this.stringLiteral = this.Lexeme(StringLiteral(def.StringStyle))
+	this.natural = this.Lexeme(natural)
+	this.integer = this.Lexeme(integer)
+	this.float = this.Lexeme(float)
+	this.naturalOrFlt = this.Lexeme(Either(Try(naturalOnly), float))
+	this.semi = this.Symbol(";")
+	this.comma = this.Symbol(",")
+	this.colon = this.Symbol(":")
+	this.dot = this.Symbol(".")
+	return this
+}
+
+func (this *TokenParser) fold(name string) string {
+	if this.def.CaseInsensitive {
+		return strings.ToLower(name)
+	}
+	return name
+}
+
+// unquoted 判断 style 是否没有设置任何引号
+func unquoted(style StringStyle) bool {
+	return style.Quotes == "" && style.RawQuotes == ""
+}
+
+// followedBy 判断下一个字符是否在 set 中，不消耗输入
+func followedBy(st ParseState, set *RuneSet) bool {
+	if set == nil {
+		return false
+	}
+	start := Save(st)
+	if _, ok, err := st.Next(set.Contains); err != nil || !ok {
+		return false
+	}
+	Restore(st, start)
+	return true
+}
+
+func (this *TokenParser) buildWhiteSpace() Parser {
+	def := this.def
+	config := WhiteSpaceConfig{
+		BlockStart:  def.CommentStart,
+		BlockEnd:    def.CommentEnd,
+		NestedBlock: def.NestedComments,
+	}
+	if def.CommentLine != "" {
+		config.LineComments = []string{def.CommentLine}
+	}
+	return WhiteSpace(config)
+}
+
+func (this *TokenParser) ident(st ParseState) (interface{}, error) {
+	start := Save(st)
+	name, err := this.identName(st)
+	if err != nil {
+		return nil, err
+	}
+	if this.reserved[this.fold(name.(string))] {
+		Restore(st, start)
+		return nil, st.Trap("unexpected reserved word %s", name)
+	}
+	return name, nil
+}
+
+func (this *TokenParser) oper(st ParseState) (interface{}, error) {
+	start := Save(st)
+	name, err := this.opName(st)
+	if err != nil {
+		return nil, err
+	}
+	if this.reservedOp[this.fold(name.(string))] {
+		Restore(st, start)
+		return nil, st.Trap("unexpected reserved operator %s", name)
+	}
+	return name, nil
+}
+
+// WhiteSpace 跳过空白、行注释和块注释
+func (this *TokenParser) WhiteSpace(st ParseState) (interface{}, error) {
+	return this.whiteSpace(st)
+}
+
+// Lexeme 执行 p 之后跳过空白和注释，返回 p 的结果
+func (this *TokenParser) Lexeme(p Parser) Parser {
+	return Bind(p, func(x interface{}) Parser {
+		return Bind_(this.whiteSpace, Return(x))
+	})
+}
+
+// Symbol 匹配字符串 s 并跳过之后的空白
+func (this *TokenParser) Symbol(s string) Parser {
+	return this.Lexeme(String(s))
+}
+
+// Identifier 匹配一个不是保留字的标识符，返回 string
+func (this *TokenParser) Identifier(st ParseState) (interface{}, error) {
+	return this.identifier(st)
+}
+
+// Reserved 匹配保留字 name ，它之后不能紧跟标识符的字符
+func (this *TokenParser) Reserved(name string) Parser {
+	word := String(name)
+	if this.def.CaseInsensitive {
+		word = StringFold(name)
+	}
+	letter := this.def.IdentLetter
+	return this.Lexeme(Try(func(st ParseState) (interface{}, error) {
+		if _, err := word(st); err != nil {
+			return nil, err
+		}
+		if followedBy(st, letter) {
+			return nil, st.Trap("expected end of %s", name)
+		}
+		return name, nil
+	}))
+}
+
+// Operator 匹配一个不是保留运算符的运算符，返回 string
+func (this *TokenParser) Operator(st ParseState) (interface{}, error) {
+	return this.operator(st)
+}
+
+// ReservedOp 匹配保留运算符 name ，它之后不能紧跟运算符的字符
+func (this *TokenParser) ReservedOp(name string) Parser {
+	op := String(name)
+	if this.def.CaseInsensitive {
+		op = StringFold(name)
+	}
+	letter := this.def.OpLetter
+	return this.Lexeme(Try(func(st ParseState) (interface{}, error) {
+		if _, err := op(st); err != nil {
+			return nil, err
+		}
+		if followedBy(st, letter) {
+			return nil, st.Trap("expected end of %s", name)
+		}
+		return name, nil
+	}))
+}
+
+// CharLiteral 匹配 LanguageDef 的 RuneStyle 描述的字符字面量，返回 rune
+func (this *TokenParser) CharLiteral(st ParseState) (interface{}, error) {
+	return this.charLiteral(st)
+}
+
+// StringLiteral 匹配 LanguageDef 的 StringStyle 描述的字符串，返回 string
+func (this *TokenParser) StringLiteral(st ParseState) (interface{}, error) {
+	return this.stringLiteral(st)
+}
+
+// Natural 匹配一个非负整数，支持 0x 、0o 和 0b 前缀，返回 int64
+func (this *TokenParser) Natural(st ParseState) (interface{}, error) {
+	return this.natural(st)
+}
+
+// Integer 匹配一个可以带符号的整数，返回 int64
+func (this *TokenParser) Integer(st ParseState) (interface{}, error) {
+	return this.integer(st)
+}
+
+// Float 匹配一个非负的浮点数，接受 1.5 、1. 、.5 和 1e3 这样的十进制写法，返回 float64
+func (this *TokenParser) Float(st ParseState) (interface{}, error) {
+	return this.float(st)
+}
+
+// NaturalOrFloat 匹配一个非负整数或者浮点数，返回 int64 或者 float64
+func (this *TokenParser) NaturalOrFloat(st ParseState) (interface{}, error) {
+	return this.naturalOrFlt(st)
+}
+
+// Parens 匹配 ( p )
+func (this *TokenParser) Parens(p Parser) Parser {
+	return Between(this.Symbol("("), this.Symbol(")"), p)
+}
+
+// Braces 匹配 { p }
+func (this *TokenParser) Braces(p Parser) Parser {
+	return Between(this.Symbol("{"), this.Symbol("}"), p)
+}
+
+// Angles 匹配 < p >
+func (this *TokenParser) Angles(p Parser) Parser {
+	return Between(this.Symbol("<"), this.Symbol(">"), p)
+}
+
+// Brackets 匹配 [ p ]
+func (this *TokenParser) Brackets(p Parser) Parser {
+	return Between(this.Symbol("["), this.Symbol("]"), p)
+}
+
+// Semi 匹配 ;
+func (this *TokenParser) Semi(st ParseState) (interface{}, error) {
+	return this.semi(st)
+}
+
+// Comma 匹配 ,
+func (this *TokenParser) Comma(st ParseState) (interface{}, error) {
+	return this.comma(st)
+}
+
+// Colon 匹配 :
+func (this *TokenParser) Colon(st ParseState) (interface{}, error) {
+	return this.colon(st)
+}
+
+// Dot 匹配 .
+func (this *TokenParser) Dot(st ParseState) (interface{}, error) {
+	return this.dot(st)
+}
+
+// SemiSep 匹配零个或多个以 ; 分隔的 p
+func (this *TokenParser) SemiSep(p Parser) Parser {
+	return SepBy(p, this.semi)
+}
+
+// SemiSep1 匹配一个或多个以 ; 分隔的 p
+func (this *TokenParser) SemiSep1(p Parser) Parser {
+	return SepBy1(p, this.semi)
+}
+
+// CommaSep 匹配零个或多个以 , 分隔的 p
+func (this *TokenParser) CommaSep(p Parser) Parser {
+	return SepBy(p, this.comma)
+}
+
+// CommaSep1 匹配一个或多个以 , 分隔的 p
+func (this *TokenParser) CommaSep1(p Parser) Parser {
+	return SepBy1(p, this.comma)
+}
+
+// stringStyle 是 Go 的解释型字符串，不包括 raw 字符串
+var stringStyle = func() StringStyle {
+	style := GoStringStyle
+	style.RawQuotes = ""
+	return style
+}()
+
+var natural = NumberFormat{Prefixes: true}.Int64()
+var integer = NumberFormat{Sign: true, Prefixes: true}.Int64()
+var float = NumberFormat{}.Float64()
+
+// fractionStart 是浮点数在整数部分之后可以出现的字符
+var fractionStart = NewRuneSet(".eE")
+
+// naturalOnly 匹配之后不是小数或指数部分的非负整数，用于 NaturalOrFloat
+func naturalOnly(st ParseState) (interface{}, error) {
+	value, err := natural(st)
+	if err != nil {
+		return nil, err
+	}
+	if followedBy(st, fractionStart) {
+		return nil, st.Trap("expected natural but found float")
+	}
+	return value, nil
+}
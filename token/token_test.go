@@ -0,0 +1,115 @@
+package token
+
+import (
+	"reflect"
+	"testing"
+	"unicode"
+
+	. "github.com/Dwarfartisan/goparsec"
+)
+
+func TestJavaStyle(t *testing.T) {
+	def := JavaStyle()
+	def.ReservedNames = []string{"var", "if"}
+	def.ReservedOpNames = []string{"="}
+	tp := NewTokenParser(def)
+	decl := Binds_(tp.WhiteSpace, tp.Reserved("var"), Bind(tp.Identifier, func(name interface{}) Parser {
+		return Bind_(tp.ReservedOp("="), Bind(tp.Brackets(tp.CommaSep(tp.NaturalOrFloat)), func(values interface{}) Parser {
+			return Bind_(Bind_(tp.Semi, Eof), Return([]interface{}{name, values}))
+		}))
+	}))
+	data := "  // declare\n var /* the /* name */ xs = [1, 0x1F, 2.5e3 /* tail */] ;"
+	val, err := decl(MemoryParseState(data))
+	if err != nil {
+		t.Fatalf("expect parse the declare but %v", err)
+	}
+	expect := []interface{}{"xs", []interface{}{int64(1), int64(31), 2500.0}}
+	if !reflect.DeepEqual(val, expect) {
+		t.Fatalf("expect %v but %v", expect, val)
+	}
+}
+
+func TestReserved(t *testing.T) {
+	def := EmptyDef()
+	def.ReservedNames = []string{"Select"}
+	def.CaseInsensitive = true
+	tp := NewTokenParser(def)
+	if _, err := tp.Identifier(MemoryParseState("SELECT")); err == nil {
+		t.Fatalf("expect SELECT is not an identifier")
+	}
+	if _, err := tp.Reserved("select")(MemoryParseState("selection")); err == nil {
+		t.Fatalf("expect reserved word select not match \"selection\"")
+	}
+	val, err := tp.Identifier(MemoryParseState("selection"))
+	if err != nil || val.(string) != "selection" {
+		t.Fatalf("expect identifier \"selection\" but %v, %v", val, err)
+	}
+}
+
+func TestLiterals(t *testing.T) {
+	tp := NewTokenParser(EmptyDef())
+	val, err := UnionAll(tp.StringLiteral, tp.CharLiteral, tp.Integer, tp.Operator)(MemoryParseState(`"a\tb" '\n' -42 <=>`))
+	if err != nil {
+		t.Fatalf("expect parse the literals but %v", err)
+	}
+	expect := []interface{}{"a\tb", '\n', int64(-42), "<=>"}
+	if !reflect.DeepEqual(val, expect) {
+		t.Fatalf("expect %v but %v", expect, val)
+	}
+}
+
+func TestLiteralErrors(t *testing.T) {
+	tp := NewTokenParser(JavaStyle())
+	_, err := tp.StringLiteral(MemoryParseState(`"ab\q"`))
+	if e, ok := err.(ParseError); !ok || e.Pos != 3 {
+		t.Fatalf("expect error at the bad escape but %v", err)
+	}
+	_, err = tp.CharLiteral(MemoryParseState(`'ab'`))
+	if err == nil {
+		t.Fatalf("expect error for multi-character rune literal")
+	}
+}
+
+func TestLiteralStyles(t *testing.T) {
+	def := EmptyDef()
+	def.StringStyle = PythonStringStyle
+	def.RuneStyle = GoRuneStyle
+	def.RuneStyle.Quotes = "`"
+	tp := NewTokenParser(def)
+	val, err := UnionAll(tp.StringLiteral, tp.StringLiteral, tp.CharLiteral)(MemoryParseState(`'a\q' r"\n" ` + "`x`"))
+	if err != nil {
+		t.Fatalf("expect parse the literals in custom styles but %v", err)
+	}
+	expect := []interface{}{`a\q`, `\n`, 'x'}
+	if !reflect.DeepEqual(val, expect) {
+		t.Fatalf("expect %v but %v", expect, val)
+	}
+}
+
+func TestReservedOp(t *testing.T) {
+	def := EmptyDef()
+	def.OpStart = new(RuneSet).AddRunes("&").AddTable(unicode.Letter)
+	def.OpLetter = def.OpStart
+	def.ReservedOpNames = []string{"And"}
+	def.CaseInsensitive = true
+	tp := NewTokenParser(def)
+	if _, err := tp.Operator(MemoryParseState("AND")); err == nil {
+		t.Fatalf("expect AND is not an operator")
+	}
+	val, err := tp.ReservedOp("And")(MemoryParseState("and"))
+	if err != nil || val.(string) != "And" {
+		t.Fatalf("expect reserved operator And match \"and\" but %v, %v", val, err)
+	}
+}
+
+func TestNumbers(t *testing.T) {
+	tp := NewTokenParser(EmptyDef())
+	val, err := UnionAll(tp.Float, tp.Float, tp.NaturalOrFloat, tp.NaturalOrFloat, tp.NaturalOrFloat)(MemoryParseState(".5 1e3 7 7.5 0x1e"))
+	if err != nil {
+		t.Fatalf("expect parse the numbers but %v", err)
+	}
+	expect := []interface{}{0.5, 1000.0, int64(7), 7.5, int64(30)}
+	if !reflect.DeepEqual(val, expect) {
+		t.Fatalf("expect %v but %v", expect, val)
+	}
+}
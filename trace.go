@@ -0,0 +1,154 @@
+package goparsec
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// TracePos 是跟踪记录中的位置
+type TracePos struct {
+	Pos    int `json:"pos"`
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+func tracePos(st ParseState) TracePos {
+	return TracePos{st.Pos(), st.Line(), st.Column()}
+}
+
+// TraceNode 是一次规则执行的记录，Children 是执行期间进入的规则
+type TraceNode struct {
+	Rule  string   `json:"rule"`
+	Start TracePos `json:"start"`
+	End   TracePos `json:"end"`
+	OK    bool     `json:"ok"`
+	// Error 是失败时的错误信息，Text 是成功时消耗的输入，state 没有实现 Scanner 时为空
+	Error    string       `json:"error,omitempty"`
+	Text     string       `json:"text,omitempty"`
+	Children []*TraceNode `json:"children,omitempty"`
+}
+
+// Tracer 把规则的执行过程记录为一棵树，同时以缩进的形式写到 io.Writer 。它用于调试，
+// 不能在多个 goroutine 中同时使用。
+type Tracer struct {
+	w     io.Writer
+	roots []*TraceNode
+	stack []*TraceNode
+}
+
+// NewTracer 创建写到 w 的 Tracer ，w 为 nil 时只记录，不输出
+func NewTracer(w io.Writer) *Tracer {
+	return &Tracer{w: w}
+}
+
+// currentTracer 保存全局跟踪模式使用的 *Tracer ，为 nil 表示没有打开跟踪
+var currentTracer atomic.Value
+
+// globalTracer 返回全局跟踪模式使用的 Tracer
+func globalTracer() *Tracer {
+	tracer, _ := currentTracer.Load().(*Tracer)
+	return tracer
+}
+
+// SetTracer 打开全局跟踪模式，所有的命名规则都记录到 tracer ，tracer 为 nil 时关闭。
+// 返回之前的 Tracer 。
+func SetTracer(tracer *Tracer) *Tracer {
+	previous, _ := currentTracer.Swap(tracer).(*Tracer)
+	return previous
+}
+
+// traceOutput 是没有打开全局跟踪时 Trace 的输出
+var traceOutput io.Writer = os.Stderr
+
+// Trace 总是跟踪 p 的执行，记录到全局跟踪模式的 Tracer ，没有打开全局跟踪时写到
+// os.Stderr 。
+func Trace(name string, p Parser) Parser {
+	n := &Node{Kind: "rule", Children: []Parser{p}, Label: name}
+	return nest(n, func(st ParseState) (interface{}, error) {
+		tracer := globalTracer()
+		if tracer == nil {
+			// 每次调用使用单独的 Tracer ，记录随着调用结束被丢弃，同时执行的解析也不会
+			// 共享它的状态
+			tracer = NewTracer(traceOutput)
+		}
+		return tracer.trace(name, p, st)
+	})
+}
+
+// Roots 返回记录下来的最外层规则
+func (this *Tracer) Roots() []*TraceNode {
+	return this.roots
+}
+
+// Reset 清除所有的记录
+func (this *Tracer) Reset() {
+	this.roots = nil
+	this.stack = nil
+}
+
+// WriteJSON 把记录的树以 JSON 格式写到 w
+func (this *Tracer) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	roots := this.roots
+	if roots == nil {
+		roots = []*TraceNode{}
+	}
+	return encoder.Encode(roots)
+}
+
+func (this *Tracer) printf(depth int, format string, args ...interface{}) {
+	if this.w != nil {
+		fmt.Fprintf(this.w, strings.Repeat("  ", depth)+format+"\n", args...)
+	}
+}
+
+// traceText 截断过长的文本，只用于缩进输出
+func traceText(text string) string {
+	runes := []rune(text)
+	if len(runes) > 40 {
+		return string(runes[:40]) + "..."
+	}
+	return text
+}
+
+// errorMessage 返回错误的说明，ParseError 只取 Message ，位置已经单独输出
+func errorMessage(err error) string {
+	if perr, ok := err.(ParseError); ok {
+		return perr.Message
+	}
+	return err.Error()
+}
+
+func (this *Tracer) trace(name string, p Parser, st ParseState) (interface{}, error) {
+	record := &TraceNode{Rule: name, Start: tracePos(st)}
+	depth := len(this.stack)
+	if depth > 0 {
+		parent := this.stack[depth-1]
+		parent.Children = append(parent.Children, record)
+	} else {
+		this.roots = append(this.roots, record)
+	}
+	this.stack = append(this.stack, record)
+	defer func() {
+		this.stack = this.stack[:depth]
+	}()
+	this.printf(depth, "> %s at %d:%d", name, record.Start.Line, record.Start.Column)
+	value, err := p(st)
+	record.End = tracePos(st)
+	if err != nil {
+		record.Error = errorMessage(err)
+		this.printf(depth, "< %s failed at %d:%d: %s", name, record.End.Line, record.End.Column, record.Error)
+		return value, err
+	}
+	record.OK = true
+	if sc, ok := st.(Scanner); ok && record.End.Pos > record.Start.Pos {
+		record.Text = sc.Text(record.Start.Pos, record.End.Pos)
+	}
+	this.printf(depth, "< %s ok at %d:%d %q", name, record.End.Line, record.End.Column, traceText(record.Text))
+	return value, nil
+}
@@ -0,0 +1,50 @@
+package goparsec
+
+// userState 返回 st 的用户数据接口，st 没有实现 UserState 时返回错误
+func userState(st ParseState) (UserState, error) {
+	for state := st; state != nil; state = unwrap(state) {
+		if user, ok := state.(UserState); ok {
+			return user, nil
+		}
+	}
+	return nil, st.Trap("state %T does not support user state", st)
+}
+
+var getStateNode = &Node{Kind: "getState", empty: true}
+
+// GetState 返回当前的用户数据，不消耗输入
+func GetState(st ParseState) (interface{}, error) {
+	user, err := userState(st)
+	if err != nil {
+		return nil, err
+	}
+	return user.UserData(), nil
+}
+
+// PutState 把用户数据设置为 value ，不消耗输入，返回 nil
+func PutState(value interface{}) Parser {
+	n := &Node{Kind: "putState", empty: true}
+	return build(n, func(st ParseState) (interface{}, error) {
+		user, err := userState(st)
+		if err != nil {
+			return nil, err
+		}
+		user.SetUserData(value)
+		return nil, nil
+	})
+}
+
+// ModifyState 用 f 的返回值替换用户数据，不消耗输入，返回新的用户数据。f 不应该修改
+// 传入的值，否则回溯时无法恢复。
+func ModifyState(f func(interface{}) interface{}) Parser {
+	n := &Node{Kind: "modifyState", empty: true}
+	return build(n, func(st ParseState) (interface{}, error) {
+		user, err := userState(st)
+		if err != nil {
+			return nil, err
+		}
+		value := f(user.UserData())
+		user.SetUserData(value)
+		return value, nil
+	})
+}
@@ -0,0 +1,68 @@
+package goparsec
+
+// backtrack 是 Backtrack 标记过的语义错误
+type backtrack struct {
+	err error
+}
+
+func (this backtrack) Error() string {
+	return this.err.Error()
+}
+
+// Backtrack 把语义检查的错误标记为可以回溯：Where 和 BindE 遇到这样的错误时会回到 p
+// 开始的位置，于是 Either 和 Choice 可以继续尝试其它分支。没有标记的错误不会回溯。
+func Backtrack(err error) error {
+	if err == nil {
+		return nil
+	}
+	return backtrack{err}
+}
+
+// semanticError 把语义检查返回的 err 转换为指向 start 位置的 ParseError ，原始错误
+// 保存在 Err 字段中。err 被 Backtrack 标记过时 st 回到 start ，否则停在当前的位置。
+func semanticError(st ParseState, start Checkpoint, err error) error {
+	retreat := false
+	if b, ok := err.(backtrack); ok {
+		err, retreat = b.err, true
+	}
+	perr := errorAt(start, "%v", err)
+	perr.Err = err
+	if retreat {
+		rewind(st, start)
+	}
+	return perr
+}
+
+// Where 执行 p ，然后用 check 检查 p 的结果，例如拒绝大于 255 的整数。check 返回的错误
+// 转换为指向 p 开始位置的 ParseError 。
+func Where(p Parser, check func(interface{}) error) Parser {
+	n := &Node{Kind: "where", Children: []Parser{p}}
+	return nest(n, func(st ParseState) (interface{}, error) {
+		start := Save(st)
+		value, err := p(st)
+		if err != nil {
+			return nil, err
+		}
+		if err := check(value); err != nil {
+			return nil, semanticError(st, start, err)
+		}
+		return value, nil
+	})
+}
+
+// BindE 与 Bind 相同，但是 fun 可以返回错误，错误转换为指向 p 开始位置的 ParseError 。
+func BindE(p Parser, fun func(interface{}) (Parser, error)) Parser {
+	n := &Node{Kind: "bind", Children: []Parser{p}}
+	return nest(n, func(st ParseState) (interface{}, error) {
+		start := Save(st)
+		value, err := p(st)
+		if err != nil {
+			return nil, err
+		}
+		next, err := fun(value)
+		if err != nil {
+			return nil, semanticError(st, start, err)
+		}
+		return next(st)
+	})
+}
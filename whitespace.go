@@ -0,0 +1,98 @@
+package goparsec
+
+import (
+	"io"
+	"unicode"
+)
+
+// WhiteSpaceConfig 描述 WhiteSpace 需要跳过的内容
+type WhiteSpaceConfig struct {
+	// Space 判断哪些字符是空白，为 nil 时使用 unicode.IsSpace
+	Space func(rune) bool
+	// LineComments 是行注释的开始标记，例如 ";" 、"//" 或 "#" ，行注释到换行符为止
+	LineComments []string
+	// BlockStart 和 BlockEnd 是块注释的开始和结束标记，例如 "/*" 和 "*/" ，为空表示不支持
+	// 块注释
+	BlockStart string
+	BlockEnd   string
+	// NestedBlock 表示块注释可以嵌套，例如 {- {- -} -}
+	NestedBlock bool
+}
+
+func isNotNewLine(r rune) bool {
+	return r != '\n'
+}
+
+// WhiteSpace 按照 config 跳过任意组合的空白、行注释和块注释，可以匹配空串，返回 nil 。
+// 块注释没有结束时返回的错误指向注释开始的位置。
+func WhiteSpace(config WhiteSpaceConfig) Parser {
+	space := config.Space
+	if space == nil {
+		space = unicode.IsSpace
+	}
+	spaces := SkipWhile(space)
+	comments := []Parser{}
+	for _, start := range config.LineComments {
+		if start != "" {
+			comments = append(comments, Bind_(String(start), SkipWhile(isNotNewLine)))
+		}
+	}
+	if config.BlockStart != "" && config.BlockEnd != "" {
+		comments = append(comments, blockComment(config.BlockStart, config.BlockEnd, config.NestedBlock))
+	}
+	n := &Node{Kind: "whiteSpace", first: space, empty: true}
+	if len(comments) > 0 {
+		// 注释的开始标记不容易表达成字符集合，这里保守地认为任何字符都可能开始注释
+		n.first = always
+	}
+	return build(n, func(st ParseState) (interface{}, error) {
+		for {
+			pos := st.Pos()
+			if _, err := spaces(st); err != nil {
+				return nil, err
+			}
+			for _, comment := range comments {
+				start := st.Pos()
+				if _, err := comment(st); err != nil && st.Pos() != start {
+					return nil, err
+				}
+			}
+			if st.Pos() == pos {
+				return nil, nil
+			}
+		}
+	})
+}
+
+// blockComment 跳过一个从 start 到 end 的块注释
+func blockComment(start, end string, nested bool) Parser {
+	opening := String(start)
+	closing := String(end)
+	return func(st ParseState) (interface{}, error) {
+		from := Save(st)
+		if _, err := opening(st); err != nil {
+			return nil, err
+		}
+		depth := 1
+		for depth > 0 {
+			if _, err := closing(st); err == nil {
+				depth--
+				continue
+			}
+			if nested {
+				if _, err := opening(st); err == nil {
+					depth++
+					continue
+				}
+			}
+			if _, _, err := st.Next(always); err != nil {
+				if err != io.EOF {
+					return nil, err
+				}
+				// 错误指向注释开始的位置，state 仍然停在出错的位置，表示已经消耗了输入
+				return nil, errorAt(from, "unterminated block comment, expected %s", end)
+			}
+		}
+		return nil, nil
+	}
+}